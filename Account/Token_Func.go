@@ -1,6 +1,7 @@
 package account
 
 import (
+	"errors"
 	"net/http"
 	"time"
 
@@ -71,6 +72,22 @@ func Login(c *gin.Context) {
 }
 
 
+// Claims of a valid token, for connections that can't go through AuthMiddleware
+func ParseToken(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return jwtKey, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+
+	return claims, nil
+}
+
 // Middleware to verify JWT token
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -86,13 +103,10 @@ func AuthMiddleware() gin.HandlerFunc {
 		tokenString = tokenString[7:]
 
 		// Parse the token
-		claims := &Claims{}
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			return jwtKey, nil
-		})
+		claims, err := ParseToken(tokenString)
 
 		// Check if the token is valid
-		if err != nil || !token.Valid {
+		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 			c.Abort()
 			return
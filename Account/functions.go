@@ -3,6 +3,7 @@ package account
 import (
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -225,6 +226,12 @@ func GetMyAccount(c *gin.Context) {
 		"bullet_elo": account.BulletElo,
 		"blitz_elo": account.BlitzElo,
 		"rapid_elo": account.RapidElo,
+		"classical_elo": account.ClassicalElo,
+		"king_of_the_hill_elo": account.KingOfTheHillElo,
+		"three_check_elo": account.ThreeCheckElo,
+		"horde_elo": account.HordeElo,
+		"correspondence_elo": account.CorrespondenceElo,
+		"vacation_until": account.VacationUntil,
 		"is_active": account.IsActive,
 	})
 }
@@ -270,6 +277,22 @@ func UpdateMyAccount(c *gin.Context) {
 		account.BlitzElo = preaccount.BlitzElo
 		account.BulletElo = preaccount.BulletElo
 		account.RapidElo = preaccount.RapidElo
+		account.ClassicalElo = preaccount.ClassicalElo
+		account.KingOfTheHillElo = preaccount.KingOfTheHillElo
+		account.ThreeCheckElo = preaccount.ThreeCheckElo
+		account.HordeElo = preaccount.HordeElo
+		account.CorrespondenceElo = preaccount.CorrespondenceElo
+
+		account.BulletRD, account.BulletVolatility = preaccount.BulletRD, preaccount.BulletVolatility
+		account.BlitzRD, account.BlitzVolatility = preaccount.BlitzRD, preaccount.BlitzVolatility
+		account.RapidRD, account.RapidVolatility = preaccount.RapidRD, preaccount.RapidVolatility
+		account.ClassicalRD, account.ClassicalVolatility = preaccount.ClassicalRD, preaccount.ClassicalVolatility
+		account.KingOfTheHillRD, account.KingOfTheHillVolatility = preaccount.KingOfTheHillRD, preaccount.KingOfTheHillVolatility
+		account.ThreeCheckRD, account.ThreeCheckVolatility = preaccount.ThreeCheckRD, preaccount.ThreeCheckVolatility
+		account.HordeRD, account.HordeVolatility = preaccount.HordeRD, preaccount.HordeVolatility
+		account.CorrespondenceRD, account.CorrespondenceVolatility = preaccount.CorrespondenceRD, preaccount.CorrespondenceVolatility
+
+		account.VacationYear, account.VacationDaysUsed, account.VacationUntil = preaccount.VacationYear, preaccount.VacationDaysUsed, preaccount.VacationUntil
 
 		account.IsActive = preaccount.IsActive
 		account.IsAdmin = preaccount.IsAdmin
@@ -362,4 +385,59 @@ func DeleteAccountbyid(c *gin.Context)  {
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Account deleted successfully"})
-}
\ No newline at end of file
+}
+
+// GET
+// Rating graph of an account in one category
+// req = id(from the url), category(from the query)
+func GetRatingHistory(c *gin.Context) {
+	category := c.Query("category")
+
+	var account Account
+	if err := db.First(&account, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+		return
+	}
+
+	current, _, _ := account.RatingFor(category)
+	if current == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid category, use " + strings.Join(ratingCategories, ", ")})
+		return
+	}
+
+	var history []RatingHistory
+	if err := db.Where("account_id = ? AND category = ?", account.ID, category).Order("created_at").Find(&history).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve rating history"})
+		return
+	}
+
+	peak, lowest, monthChange := *current, *current, 0
+	monthAgo := time.Now().AddDate(0, 0, -30)
+
+	points := make([]gin.H, 0, len(history))
+	for _, point := range history {
+		peak = max(peak, point.Rating)
+		lowest = min(lowest, point.Rating)
+
+		if point.CreatedAt.After(monthAgo) {
+			monthChange += point.Change
+		}
+
+		points = append(points, gin.H{
+			"time":    point.CreatedAt,
+			"rating":  point.Rating,
+			"change":  point.Change,
+			"game_id": point.GameID,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"account_id":     account.ID,
+		"category":       category,
+		"rating":         *current,
+		"peak":           peak,
+		"lowest":         lowest,
+		"change_30_days": monthChange,
+		"points":         points,
+	})
+}
@@ -16,6 +16,38 @@ type Account struct {
 	BulletElo int			`gorm:"default:200"`
 	BlitzElo int			`gorm:"default:200"`
 	RapidElo int			`gorm:"default:200"`
+	ClassicalElo int		`gorm:"default:200"`
+
+	// Variants are rated in their own pools, whatever the time control
+	KingOfTheHillElo int	`gorm:"default:200"`
+	ThreeCheckElo int		`gorm:"default:200"`
+	HordeElo int			`gorm:"default:200"`
+	CorrespondenceElo int	`gorm:"default:200"`
+
+	// Glicko-2 deviation and volatility of each rating
+	BulletRD float64		`gorm:"default:350"`
+	BlitzRD float64			`gorm:"default:350"`
+	RapidRD float64			`gorm:"default:350"`
+	ClassicalRD float64		`gorm:"default:350"`
+	KingOfTheHillRD float64	`gorm:"default:350"`
+	ThreeCheckRD float64	`gorm:"default:350"`
+	HordeRD float64			`gorm:"default:350"`
+	CorrespondenceRD float64	`gorm:"default:350"`
+
+	BulletVolatility float64	`gorm:"default:0.06"`
+	BlitzVolatility float64		`gorm:"default:0.06"`
+	RapidVolatility float64		`gorm:"default:0.06"`
+	ClassicalVolatility float64	`gorm:"default:0.06"`
+	KingOfTheHillVolatility float64	`gorm:"default:0.06"`
+	ThreeCheckVolatility float64	`gorm:"default:0.06"`
+	HordeVolatility float64		`gorm:"default:0.06"`
+	CorrespondenceVolatility float64	`gorm:"default:0.06"`
+
+	// Correspondence vacation: the days taken in VacationYear
+	// and the end of the current one
+	VacationYear int
+	VacationDaysUsed int
+	VacationUntil time.Time
 
 	ActivationToken string    `json:"activation_token"`
 	TokenExpiresAt  time.Time `json:"token_expires_at"`
@@ -23,4 +55,47 @@ type Account struct {
 	IsActive  bool 			`gorm:"default:false"`
 
 	IsAdmin   bool 			`gorm:"default:false"`
-}
\ No newline at end of file
+}
+
+// One rating change of an account, written for every rated game
+type RatingHistory struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	AccountID string    `json:"account_id" gorm:"index"`
+	Category  string    `json:"category" gorm:"index"`
+	GameID    string    `json:"game_id"`
+
+	Rating    int       `json:"rating"`
+	Change    int       `json:"change"`
+	Deviation float64   `json:"deviation"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Every category with its own rating, the ones RatingFor knows
+var ratingCategories = []string{"bullet", "blitz", "rapid", "classical", "correspondence", "king_of_the_hill", "three_check", "horde"}
+
+// Rating fields of a game category (bullet, blitz, rapid, classical or correspondence)
+// or of a variant pool (king_of_the_hill, three_check or horde)
+// returns nil pointers for an unknown category
+func (a *Account) RatingFor(category string) (*int, *float64, *float64) {
+	switch category {
+	case "bullet":
+		return &a.BulletElo, &a.BulletRD, &a.BulletVolatility
+	case "blitz":
+		return &a.BlitzElo, &a.BlitzRD, &a.BlitzVolatility
+	case "rapid":
+		return &a.RapidElo, &a.RapidRD, &a.RapidVolatility
+	case "classical":
+		return &a.ClassicalElo, &a.ClassicalRD, &a.ClassicalVolatility
+	case "correspondence":
+		return &a.CorrespondenceElo, &a.CorrespondenceRD, &a.CorrespondenceVolatility
+	case "king_of_the_hill":
+		return &a.KingOfTheHillElo, &a.KingOfTheHillRD, &a.KingOfTheHillVolatility
+	case "three_check":
+		return &a.ThreeCheckElo, &a.ThreeCheckRD, &a.ThreeCheckVolatility
+	case "horde":
+		return &a.HordeElo, &a.HordeRD, &a.HordeVolatility
+	}
+
+	return nil, nil, nil
+}
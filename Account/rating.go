@@ -0,0 +1,185 @@
+package account
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+
+	"gorm.io/gorm"
+)
+
+// Glicko-2 constants
+const (
+	glickoScale      = 173.7178
+	glickoTau        = 0.5
+	glickoEpsilon    = 0.000001
+	minDeviation     = 30
+	maxDeviation     = 350
+	defaultEloFactor = 20
+)
+
+// Ratings of both players before and after a game
+type RatingChange struct {
+	WhiteBefore int `json:"white_before"`
+	WhiteAfter  int `json:"white_after"`
+	BlackBefore int `json:"black_before"`
+	BlackAfter  int `json:"black_after"`
+}
+
+type rating struct {
+	Rating     float64
+	Deviation  float64
+	Volatility float64
+}
+
+// Updates the ratings of two players after a game of the given category
+// and writes both changes to their rating history, inside tx so the caller
+// can save the result of the game with them, nothing is written on an error
+// score is from white's point of view: 1 win, 0.5 draw, 0 loss
+// RATING_SYSTEM=elo switches from Glicko-2 to Elo with ELO_K_FACTOR
+func UpdateRatings(tx *gorm.DB, gameID string, whiteID string, blackID string, category string, score float64) (RatingChange, error) {
+	var change RatingChange
+
+	err := tx.Transaction(func(tx *gorm.DB) error {
+		var white, black Account
+		if err := tx.First(&white, "id = ?", whiteID).Error; err != nil {
+			return fmt.Errorf("white account not found: %w", err)
+		}
+		if err := tx.First(&black, "id = ?", blackID).Error; err != nil {
+			return fmt.Errorf("black account not found: %w", err)
+		}
+
+		whiteElo, whiteRD, whiteVol := white.RatingFor(category)
+		blackElo, blackRD, blackVol := black.RatingFor(category)
+		if whiteElo == nil || blackElo == nil {
+			return fmt.Errorf("unknown rating category %q", category)
+		}
+
+		whiteRating := rating{float64(*whiteElo), *whiteRD, *whiteVol}
+		blackRating := rating{float64(*blackElo), *blackRD, *blackVol}
+
+		var newWhite, newBlack rating
+		if os.Getenv("RATING_SYSTEM") == "elo" {
+			k := eloFactor()
+			newWhite = eloUpdate(whiteRating, blackRating, score, k)
+			newBlack = eloUpdate(blackRating, whiteRating, 1-score, k)
+		} else {
+			newWhite = glickoUpdate(whiteRating, blackRating, score)
+			newBlack = glickoUpdate(blackRating, whiteRating, 1-score)
+		}
+
+		change.WhiteBefore, change.BlackBefore = *whiteElo, *blackElo
+
+		*whiteElo, *whiteRD, *whiteVol = int(math.Round(newWhite.Rating)), newWhite.Deviation, newWhite.Volatility
+		*blackElo, *blackRD, *blackVol = int(math.Round(newBlack.Rating)), newBlack.Deviation, newBlack.Volatility
+
+		change.WhiteAfter, change.BlackAfter = *whiteElo, *blackElo
+
+		if err := tx.Save(&white).Error; err != nil {
+			return err
+		}
+		if err := tx.Save(&black).Error; err != nil {
+			return err
+		}
+
+		history := []RatingHistory{
+			{
+				AccountID: white.ID,
+				Category:  category,
+				GameID:    gameID,
+				Rating:    change.WhiteAfter,
+				Change:    change.WhiteAfter - change.WhiteBefore,
+				Deviation: *whiteRD,
+			},
+			{
+				AccountID: black.ID,
+				Category:  category,
+				GameID:    gameID,
+				Rating:    change.BlackAfter,
+				Change:    change.BlackAfter - change.BlackBefore,
+				Deviation: *blackRD,
+			},
+		}
+
+		return tx.Create(&history).Error
+	})
+
+	return change, err
+}
+
+func eloFactor() float64 {
+	k, err := strconv.ParseFloat(os.Getenv("ELO_K_FACTOR"), 64)
+	if err != nil || k <= 0 {
+		return defaultEloFactor
+	}
+
+	return k
+}
+
+func eloUpdate(player rating, opponent rating, score float64, k float64) rating {
+	expected := 1 / (1 + math.Pow(10, (opponent.Rating-player.Rating)/400))
+	player.Rating += k * (score - expected)
+
+	return player
+}
+
+// One game rating period of Glicko-2 (http://www.glicko.net/glicko/glicko2.pdf)
+func glickoUpdate(player rating, opponent rating, score float64) rating {
+	mu := (player.Rating - 1500) / glickoScale
+	phi := player.Deviation / glickoScale
+	muJ := (opponent.Rating - 1500) / glickoScale
+	phiJ := opponent.Deviation / glickoScale
+
+	g := 1 / math.Sqrt(1+3*phiJ*phiJ/(math.Pi*math.Pi))
+	expected := 1 / (1 + math.Exp(-g*(mu-muJ)))
+	v := 1 / (g * g * expected * (1 - expected))
+	delta := v * g * (score - expected)
+
+	sigma := newVolatility(phi, player.Volatility, v, delta)
+
+	phiStar := math.Sqrt(phi*phi + sigma*sigma)
+	newPhi := 1 / math.Sqrt(1/(phiStar*phiStar)+1/v)
+	newMu := mu + newPhi*newPhi*g*(score-expected)
+
+	return rating{
+		Rating:     newMu*glickoScale + 1500,
+		Deviation:  math.Min(math.Max(newPhi*glickoScale, minDeviation), maxDeviation),
+		Volatility: sigma,
+	}
+}
+
+// Illinois algorithm from step 5 of the Glicko-2 paper
+func newVolatility(phi float64, sigma float64, v float64, delta float64) float64 {
+	a := math.Log(sigma * sigma)
+	f := func(x float64) float64 {
+		ex := math.Exp(x)
+		return ex*(delta*delta-phi*phi-v-ex)/(2*math.Pow(phi*phi+v+ex, 2)) - (x-a)/(glickoTau*glickoTau)
+	}
+
+	A := a
+	var B float64
+	if delta*delta > phi*phi+v {
+		B = math.Log(delta*delta - phi*phi - v)
+	} else {
+		k := 1.0
+		for f(a-k*glickoTau) < 0 {
+			k++
+		}
+		B = a - k*glickoTau
+	}
+
+	fA, fB := f(A), f(B)
+	for math.Abs(B-A) > glickoEpsilon {
+		C := A + (A-B)*fA/(fB-fA)
+		fC := f(C)
+		if fC*fB <= 0 {
+			A, fA = B, fB
+		} else {
+			fA /= 2
+		}
+		B, fB = C, fC
+	}
+
+	return math.Exp(A / 2)
+}
@@ -0,0 +1,88 @@
+package account
+
+import (
+	"math"
+	"testing"
+)
+
+func near(got float64, want float64, tolerance float64) bool {
+	return math.Abs(got-want) <= tolerance
+}
+
+func TestGlickoUpdate(t *testing.T) {
+	tests := []struct {
+		name     string
+		player   rating
+		opponent rating
+		score    float64
+		want     rating
+	}{
+		{"win against a lower rating", rating{1500, 200, 0.06}, rating{1400, 30, 0.06}, 1, rating{1563.56, 175.40, 0.06}},
+		{"loss against a higher rating", rating{1500, 200, 0.06}, rating{1550, 100, 0.06}, 0, rating{1426.69, 175.90, 0.06}},
+		{"draw between new players", rating{1500, 350, 0.06}, rating{1500, 350, 0.06}, 0.5, rating{1500, 290.32, 0.06}},
+		{"win between settled players", rating{1500, 50, 0.06}, rating{1500, 50, 0.06}, 1, rating{1507.26, 50.54, 0.06}},
+		{"deviation kept at its minimum", rating{1500, 30, 0.0001}, rating{1500, 30, 0.0001}, 0.5, rating{1500, minDeviation, 0.0001}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := glickoUpdate(tt.player, tt.opponent, tt.score)
+
+			if !near(got.Rating, tt.want.Rating, 0.01) || !near(got.Deviation, tt.want.Deviation, 0.01) || !near(got.Volatility, tt.want.Volatility, 0.0001) {
+				t.Errorf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// Step 5 of the example in the Glicko-2 paper
+func TestNewVolatilityPaperExample(t *testing.T) {
+	if got := newVolatility(1.1513, 0.06, 1.7785, -0.4834); !near(got, 0.05999, 0.00001) {
+		t.Errorf("got %f, want 0.05999", got)
+	}
+}
+
+func TestEloUpdate(t *testing.T) {
+	tests := []struct {
+		name     string
+		player   float64
+		opponent float64
+		score    float64
+		k        float64
+		want     float64
+	}{
+		{"win between equals", 1500, 1500, 1, 20, 1510},
+		{"draw between equals", 1500, 1500, 0.5, 20, 1500},
+		{"loss between equals", 1500, 1500, 0, 32, 1484},
+		{"expected win", 1600, 1400, 1, 20, 1604.81},
+		{"upset loss", 1600, 1400, 0, 20, 1584.81},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := eloUpdate(rating{Rating: tt.player}, rating{Rating: tt.opponent}, tt.score, tt.k)
+			if !near(got.Rating, tt.want, 0.01) {
+				t.Errorf("got %.2f, want %.2f", got.Rating, tt.want)
+			}
+		})
+	}
+}
+
+func TestEloFactor(t *testing.T) {
+	tests := []struct {
+		env  string
+		want float64
+	}{
+		{"", defaultEloFactor},
+		{"32", 32},
+		{"-5", defaultEloFactor},
+		{"fast", defaultEloFactor},
+	}
+
+	for _, tt := range tests {
+		t.Setenv("ELO_K_FACTOR", tt.env)
+		if got := eloFactor(); got != tt.want {
+			t.Errorf("ELO_K_FACTOR=%q: got %v, want %v", tt.env, got, tt.want)
+		}
+	}
+}
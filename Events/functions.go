@@ -0,0 +1,185 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var db *gorm.DB
+
+func Init(database *gorm.DB) {
+	db = database
+}
+
+const (
+	// Events older than this are not replayed anymore
+	eventRetention  = 7 * 24 * time.Hour
+	keepAlivePeriod = 25 * time.Second
+	replayBatch     = 100
+)
+
+// Open streams of every account, each one is woken up when an event is stored
+type eventBroker struct {
+	mu      sync.Mutex
+	streams map[string]map[chan struct{}]bool
+}
+
+var broker = &eventBroker{streams: map[string]map[chan struct{}]bool{}}
+
+func (b *eventBroker) subscribe(accountID string) chan struct{} {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	wake := make(chan struct{}, 1)
+	if b.streams[accountID] == nil {
+		b.streams[accountID] = map[chan struct{}]bool{}
+	}
+	b.streams[accountID][wake] = true
+
+	return wake
+}
+
+func (b *eventBroker) unsubscribe(accountID string, wake chan struct{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.streams[accountID], wake)
+	if len(b.streams[accountID]) == 0 {
+		delete(b.streams, accountID)
+	}
+}
+
+// A stream already woken up reads every new event anyway
+func (b *eventBroker) notify(accountID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for wake := range b.streams[accountID] {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Stores an event for the account and wakes up its open streams,
+// a failure is only logged since the change it reports is already saved
+func Publish(accountID string, eventType string, data interface{}) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("failed to encode the %s event of account %s: %v", eventType, accountID, err)
+		return
+	}
+
+	event := Event{AccountID: accountID, Type: eventType, Data: string(encoded)}
+	if err := db.Create(&event).Error; err != nil {
+		log.Printf("failed to save the %s event of account %s: %v", eventType, accountID, err)
+		return
+	}
+
+	db.Where("account_id = ? AND created_at < ?", accountID, time.Now().Add(-eventRetention)).Delete(&Event{})
+
+	broker.notify(accountID)
+}
+
+// Id of the last event the client got, from the Last-Event-ID header
+// or the last_event_id query for clients that can't set it
+func lastEventID(c *gin.Context) (uint, bool, error) {
+	value := c.GetHeader("Last-Event-ID")
+	if value == "" {
+		value = c.Query("last_event_id")
+	}
+	if value == "" {
+		return 0, false, nil
+	}
+
+	parsed, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("Last-Event-ID must be an event id")
+	}
+
+	return uint(parsed), true, nil
+}
+
+// GET
+// Server-Sent Events of your account: challenges, games started, opponents' moves and team invitations
+// req = Last-Event-ID (header) or last_event_id (query) to replay the events missed since that one
+func Stream(c *gin.Context) {
+	accountID, ID_exists := c.Get("accountID")
+	if !ID_exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	id := accountID.(string)
+
+	lastID, resume, err := lastEventID(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Subscribed before reading so an event stored in between is not missed
+	wake := broker.subscribe(id)
+	defer broker.unsubscribe(id, wake)
+
+	// A new stream only gets what happens from now on
+	if !resume {
+		if err := db.Model(&Event{}).Where("account_id = ?", id).Select("COALESCE(MAX(id), 0)").Scan(&lastID).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+	c.Status(http.StatusOK)
+
+	fmt.Fprint(c.Writer, "retry: 3000\n\n")
+	c.Writer.Flush()
+
+	keepAlive := time.NewTicker(keepAlivePeriod)
+	defer keepAlive.Stop()
+
+	for {
+		for {
+			var pending []Event
+			if err := db.Where("account_id = ? AND id > ?", id, lastID).Order("id").Limit(replayBatch).Find(&pending).Error; err != nil {
+				log.Printf("failed to read the events of account %s: %v", id, err)
+				return
+			}
+
+			for _, event := range pending {
+				if _, err := fmt.Fprintf(c.Writer, "id: %d\nevent: %s\ndata: %s\n\n", event.ID, event.Type, event.Data); err != nil {
+					return
+				}
+				lastID = event.ID
+			}
+			c.Writer.Flush()
+
+			if len(pending) < replayBatch {
+				break
+			}
+		}
+
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-wake:
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(c.Writer, ": ping\n\n"); err != nil {
+				return
+			}
+			c.Writer.Flush()
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package events
+
+import (
+	"time"
+)
+
+// Kinds of events pushed to an account
+const (
+	TypeChallenge          = "challenge"
+	TypeChallengeDeclined  = "challenge_declined"
+	TypeChallengeCancelled = "challenge_cancelled"
+	TypeGameStarted        = "game_started"
+	TypeOpponentMove       = "opponent_move"
+	TypeTeamInvitation     = "team_invitation"
+)
+
+// Event kept for an account so a reconnecting stream can replay what it missed,
+// the ID is the SSE event id
+type Event struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	AccountID string    `json:"account_id" gorm:"index"`
+	Type      string    `json:"type"`
+	Data      string    `json:"data"` // JSON
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,143 @@
+package game
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/notnil/chess"
+)
+
+// Points of each piece for the material balance
+var pieceValues = map[chess.PieceType]int{
+	chess.Pawn:   1,
+	chess.Knight: 3,
+	chess.Bishop: 3,
+	chess.Rook:   5,
+	chess.Queen:  9,
+}
+
+// POST
+// Analyse a position without a game: plays the moves from the FEN with the same
+// rules as MakeMove and describes the position reached
+// req = fen (start position when empty), moves, notation (san, uci or lan, detected when empty), variant (not bughouse)
+func AnalyzePosition(c *gin.Context) {
+	var input struct {
+		FEN      string   `json:"fen"`
+		Moves    []string `json:"moves"`
+		Notation string   `json:"notation"`
+		Variant  string   `json:"variant"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if input.Variant == "" {
+		input.Variant = VariantStandard
+	}
+	rules, ok := variants[input.Variant]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown variant"})
+		return
+	}
+	// Drops and mates depend on the pockets, which only a game keeps
+	if input.Variant == VariantBughouse {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Bughouse positions can't be analysed without their game"})
+		return
+	}
+	if input.FEN == "" {
+		input.FEN = rules.startFEN()
+	}
+
+	pos, err := newPosition(input.FEN, rules)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// A game that is never saved, for the repetition and move rules
+	game := Game{Variant: input.Variant, StartFEN: pos.fen}
+	recordPosition(&game, pos)
+
+	// Moves after an illegal one are not played
+	moves := make([]gin.H, 0, len(input.Moves))
+	illegal := false
+	for _, moveStr := range input.Moves {
+		if illegal {
+			moves = append(moves, gin.H{"move": moveStr, "legal": false, "error": "Not played after an illegal move"})
+			continue
+		}
+
+		played, err := pos.play(moveStr, input.Notation)
+		if err != nil {
+			illegal = true
+			moves = append(moves, gin.H{"move": moveStr, "legal": false, "error": err.Error()})
+			continue
+		}
+
+		game.Moves = append(game.Moves, played.san)
+		recordPosition(&game, played.after)
+		pos = played.after
+
+		info := moveInfo(played)
+		info["move"], info["legal"], info["fen"] = moveStr, true, pos.fen
+		moves = append(moves, info)
+	}
+
+	plies := pos.legalPlies()
+	sort.Slice(plies, func(i, j int) bool { return plies[i].uci < plies[j].uci })
+
+	legalMoves := make([]gin.H, 0, len(plies))
+	for _, played := range plies {
+		legalMoves = append(legalMoves, moveInfo(played))
+	}
+
+	result, termination := detectOutcome(&game, pos)
+
+	c.JSON(http.StatusOK, gin.H{
+		"fen":         pos.fen,
+		"turn":        strings.ToLower(pos.turn().Name()),
+		"check":       pos.inCheck(),
+		"status":      analysisStatus(pos, termination),
+		"result":      result,
+		"termination": termination,
+		"moves":       moves,
+		"legal_moves": legalMoves,
+		"material":    materialBalance(pos),
+	})
+}
+
+// Short description of the position: checkmate, stalemate, insufficient_material,
+// another ending, check or ongoing
+func analysisStatus(pos *position, termination string) string {
+	switch {
+	case termination != "":
+		return termination
+	case pos.inCheck():
+		return "check"
+	}
+
+	return "ongoing"
+}
+
+// Points of both sides and the difference, positive when white is ahead
+func materialBalance(pos *position) gin.H {
+	white, black := 0, 0
+	for _, piece := range pos.squares {
+		switch piece.Color() {
+		case chess.White:
+			white += pieceValues[piece.Type()]
+		case chess.Black:
+			black += pieceValues[piece.Type()]
+		}
+	}
+
+	return gin.H{
+		"white":   white,
+		"black":   black,
+		"balance": white - black,
+	}
+}
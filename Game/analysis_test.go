@@ -0,0 +1,27 @@
+package game
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestAnalyzePositionVariants(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		wantCode int
+	}{
+		{"standard", `{"moves": ["e4", "e5"]}`, http.StatusOK},
+		{"horde", `{"variant": "horde", "moves": ["e4"]}`, http.StatusOK},
+		{"bughouse", `{"variant": "bughouse", "moves": ["e4", "e5", "N@f3"]}`, http.StatusBadRequest},
+		{"unknown", `{"variant": "atomic"}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := apiRequest(http.MethodPost, "/analysis", "alice", tt.body); w.Code != tt.wantCode {
+				t.Errorf("got %d %s, want %d", w.Code, w.Body.String(), tt.wantCode)
+			}
+		})
+	}
+}
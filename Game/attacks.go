@@ -0,0 +1,111 @@
+package game
+
+import "github.com/notnil/chess"
+
+var (
+	knightJumps = [][2]int{{1, 2}, {2, 1}, {2, -1}, {1, -2}, {-1, -2}, {-2, -1}, {-2, 1}, {-1, 2}}
+	kingSteps   = [][2]int{{1, 0}, {1, 1}, {0, 1}, {-1, 1}, {-1, 0}, {-1, -1}, {0, -1}, {1, -1}}
+	rookRays    = [][2]int{{1, 0}, {-1, 0}, {0, 1}, {0, -1}}
+	bishopRays  = [][2]int{{1, 1}, {1, -1}, {-1, 1}, {-1, -1}}
+)
+
+// Square at a file and rank offset, false when it is off the board
+func offsetSquare(sq chess.Square, df int, dr int) (chess.Square, bool) {
+	file, rank := int(sq.File())+df, int(sq.Rank())+dr
+	if file < 0 || file > 7 || rank < 0 || rank > 7 {
+		return chess.NoSquare, false
+	}
+
+	return chess.NewSquare(chess.File(file), chess.Rank(rank)), true
+}
+
+// Whether a piece of the color attacks the square
+func squareAttacked(pieces map[chess.Square]chess.Piece, sq chess.Square, by chess.Color) bool {
+	is := func(target chess.Square, types ...chess.PieceType) bool {
+		piece, ok := pieces[target]
+		if !ok || piece == chess.NoPiece || piece.Color() != by {
+			return false
+		}
+		for _, t := range types {
+			if piece.Type() == t {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Pawns attack forward, so look backwards from the square
+	pawnRank := -1
+	if by == chess.Black {
+		pawnRank = 1
+	}
+	for _, df := range []int{-1, 1} {
+		if from, ok := offsetSquare(sq, df, pawnRank); ok && is(from, chess.Pawn) {
+			return true
+		}
+	}
+
+	for _, jump := range knightJumps {
+		if from, ok := offsetSquare(sq, jump[0], jump[1]); ok && is(from, chess.Knight) {
+			return true
+		}
+	}
+
+	for _, step := range kingSteps {
+		if from, ok := offsetSquare(sq, step[0], step[1]); ok && is(from, chess.King) {
+			return true
+		}
+	}
+
+	slide := func(rays [][2]int, types ...chess.PieceType) bool {
+		for _, ray := range rays {
+			from, ok := offsetSquare(sq, ray[0], ray[1])
+			for ok {
+				if piece, found := pieces[from]; found && piece != chess.NoPiece {
+					if is(from, types...) {
+						return true
+					}
+					break
+				}
+				from, ok = offsetSquare(from, ray[0], ray[1])
+			}
+		}
+		return false
+	}
+
+	return slide(rookRays, chess.Rook, chess.Queen) || slide(bishopRays, chess.Bishop, chess.Queen)
+}
+
+func kingSquare(pieces map[chess.Square]chess.Piece, color chess.Color) (chess.Square, bool) {
+	for sq, piece := range pieces {
+		if piece.Type() == chess.King && piece.Color() == color {
+			return sq, true
+		}
+	}
+
+	return chess.NoSquare, false
+}
+
+// Neither side can mate: only kings and a single minor piece,
+// or only bishops that all stand on squares of one color
+func insufficientMaterial(pieces map[chess.Square]chess.Piece) bool {
+	minors := 0
+	bishopColors := map[int]bool{}
+	onlyBishops := true
+
+	for sq, piece := range pieces {
+		switch piece.Type() {
+		case chess.King, chess.NoPieceType:
+		case chess.Knight:
+			minors++
+			onlyBishops = false
+		case chess.Bishop:
+			minors++
+			bishopColors[(int(sq.File())+int(sq.Rank()))%2] = true
+		default:
+			return false
+		}
+	}
+
+	return minors <= 1 || (onlyBishops && len(bishopColors) == 1)
+}
@@ -0,0 +1,364 @@
+package game
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/notnil/chess"
+	chessimage "github.com/notnil/chess/image"
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+var (
+	lightSquare   = color.RGBA{240, 217, 181, 255}
+	darkSquare    = color.RGBA{181, 136, 99, 255}
+	lastMoveColor = color.RGBA{205, 210, 106, 255}
+	checkColor    = color.RGBA{235, 97, 80, 255}
+)
+
+const (
+	defaultSquareSize = 60
+	maxSquareSize     = 200
+
+	// Size of a square in the SVG of the chess package
+	svgSquareSize = 45
+)
+
+// What to draw besides the pieces
+type boardOptions struct {
+	flip       bool
+	squareSize int
+	lastMove   []chess.Square
+	check      chess.Square
+}
+
+// Options from the query: flip (black at the bottom) and size (pixels per square, PNG only)
+func boardOptionsFrom(c *gin.Context) (boardOptions, bool) {
+	opts := boardOptions{squareSize: defaultSquareSize, check: chess.NoSquare}
+
+	if flip := c.Query("flip"); flip != "" {
+		parsed, err := strconv.ParseBool(flip)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "flip must be true or false"})
+			return opts, false
+		}
+		opts.flip = parsed
+	}
+
+	if size := c.Query("size"); size != "" {
+		parsed, err := strconv.Atoi(size)
+		if err != nil || parsed < 10 || parsed > maxSquareSize {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "size must be between 10 and 200"})
+			return opts, false
+		}
+		opts.squareSize = parsed
+	}
+
+	return opts, true
+}
+
+// Highlights the last move and the king in check
+func (opts *boardOptions) highlight(pos *position, last *ply) {
+	if last != nil {
+		// Drops ("N@f3") only mark the square the piece was put on
+		squares := []string{last.uci}
+		if _, target, isDrop := strings.Cut(last.uci, "@"); isDrop {
+			squares = []string{target}
+		} else if len(last.uci) >= 4 {
+			squares = []string{last.uci[:2], last.uci[2:4]}
+		}
+
+		for _, name := range squares {
+			if sq, ok := parseSquare(name); ok {
+				opts.lastMove = append(opts.lastMove, sq)
+			}
+		}
+	}
+
+	if pos.inCheck() {
+		opts.check, _ = kingSquare(pos.squares, pos.turn())
+	}
+}
+
+func writeBoardSVG(w io.Writer, pos *position, opts boardOptions) error {
+	perspective := chess.White
+	if opts.flip {
+		perspective = chess.Black
+	}
+
+	var checks []chess.Square
+	if opts.check != chess.NoSquare {
+		checks = append(checks, opts.check)
+	}
+
+	return chessimage.SVG(w, chess.NewBoard(pos.squares),
+		chessimage.SquareColors(lightSquare, darkSquare),
+		chessimage.Perspective(perspective),
+		chessimage.MarkSquares(lastMoveColor, opts.lastMove...),
+		chessimage.MarkSquares(checkColor, checks...),
+	)
+}
+
+// Pieces of the chess package's SVG set, drawn once at 200 pixels
+//
+//go:embed pieces/*.png
+var pieceFiles embed.FS
+
+var pieceImages = func() map[chess.Piece]image.Image {
+	images := map[chess.Piece]image.Image{}
+	for _, side := range []chess.Color{chess.White, chess.Black} {
+		for _, pieceType := range []chess.PieceType{chess.King, chess.Queen, chess.Rook, chess.Bishop, chess.Knight, chess.Pawn} {
+			name := side.String() + pieceLetters[pieceType]
+			if pieceType == chess.Pawn {
+				name += "P"
+			}
+
+			file, err := pieceFiles.Open("pieces/" + name + ".png")
+			if err != nil {
+				panic(fmt.Sprintf("piece image %s: %v", name, err))
+			}
+			img, err := png.Decode(file)
+			file.Close()
+			if err != nil {
+				panic(fmt.Sprintf("piece image %s: %v", name, err))
+			}
+
+			images[chess.NewPiece(pieceType, side)] = img
+		}
+	}
+
+	return images
+}()
+
+// Pieces already scaled to a square size, GIFs draw the same ones on every
+// frame. Only a few sizes are kept so odd sizes can't fill the memory
+const maxScaledSizes = 8
+
+var (
+	scaledMu     sync.Mutex
+	scaledPieces = map[int]map[chess.Piece]*image.RGBA{}
+)
+
+func scaledPiece(piece chess.Piece, size int) *image.RGBA {
+	scaledMu.Lock()
+	defer scaledMu.Unlock()
+
+	pieces, ok := scaledPieces[size]
+	if !ok {
+		if len(scaledPieces) >= maxScaledSizes {
+			scaledPieces = map[int]map[chess.Piece]*image.RGBA{}
+		}
+		pieces = map[chess.Piece]*image.RGBA{}
+		scaledPieces[size] = pieces
+	}
+
+	if scaled, ok := pieces[piece]; ok {
+		return scaled
+	}
+
+	source := pieceImages[piece]
+	scaled := image.NewRGBA(image.Rect(0, 0, size, size))
+	xdraw.CatmullRom.Scale(scaled, scaled.Bounds(), source, source.Bounds(), xdraw.Src, nil)
+	pieces[piece] = scaled
+
+	return scaled
+}
+
+// Draws the board like its SVG: the squares, their marks at 20% opacity,
+// the pieces and the rank and file labels in the color of the other square
+func drawBoard(pos *position, opts boardOptions) (*image.RGBA, error) {
+	size := opts.squareSize
+	img := image.NewRGBA(image.Rect(0, 0, 8*size, 8*size))
+
+	marks := map[chess.Square]color.RGBA{}
+	for _, sq := range opts.lastMove {
+		marks[sq] = lastMoveColor
+	}
+	if opts.check != chess.NoSquare {
+		marks[opts.check] = checkColor
+	}
+
+	// Labels are 11 pixels high on the 45 pixel squares of the SVG
+	labelHeight := max(13*size/svgSquareSize, 1)
+	labelAscent := 11 * size / svgSquareSize
+
+	for row := 0; row < 8; row++ {
+		for col := 0; col < 8; col++ {
+			file, rank := chess.File(col), chess.Rank(7-row)
+			if opts.flip {
+				file, rank = chess.File(7-col), chess.Rank(row)
+			}
+			sq := chess.NewSquare(file, rank)
+			square := image.Rect(col*size, row*size, (col+1)*size, (row+1)*size)
+
+			background, ink := lightSquare, darkSquare
+			if (int(file)+int(rank))%2 == 0 {
+				background, ink = darkSquare, lightSquare
+			}
+			if mark, ok := marks[sq]; ok {
+				background = mixColors(background, mark, 0.2)
+			}
+			draw.Draw(img, square, image.NewUniform(background), image.Point{}, draw.Src)
+
+			if piece, ok := pos.squares[sq]; ok && piece != chess.NoPiece {
+				draw.Draw(img, square, scaledPiece(piece, size), image.Point{}, draw.Over)
+			}
+
+			if col == 0 {
+				label := rank.String()
+				width := textWidth(labelHeight, label)
+				left, top := square.Min.X+size/20, square.Min.Y+size*5/20-labelAscent
+				drawText(img, image.Pt(left+width/2, top+labelHeight/2), labelHeight, label, ink)
+			}
+			if row == 7 {
+				label := file.String()
+				width := textWidth(labelHeight, label)
+				right, top := square.Min.X+size*19/20, square.Max.Y-size/15-labelAscent
+				drawText(img, image.Pt(right-width/2, top+labelHeight/2), labelHeight, label, ink)
+			}
+		}
+	}
+
+	return img, nil
+}
+
+func writeBoardPNG(w io.Writer, pos *position, opts boardOptions) error {
+	img, err := drawBoard(pos, opts)
+	if err != nil {
+		return err
+	}
+
+	return png.Encode(w, img)
+}
+
+// Width in pixels of a basicfont text scaled up to the given height
+func textWidth(height int, text string) int {
+	face := basicfont.Face7x13
+	return height * face.Width * len(text) / face.Height
+}
+
+// Draws a basicfont text scaled up to the given height, centered on a point
+func drawText(img draw.Image, center image.Point, height int, text string, ink color.Color) {
+	face := basicfont.Face7x13
+	glyphs := image.NewRGBA(image.Rect(0, 0, face.Width*len(text), face.Height))
+
+	drawer := font.Drawer{
+		Dst:  glyphs,
+		Src:  image.NewUniform(ink),
+		Face: face,
+		Dot:  fixed.P(0, face.Ascent),
+	}
+	drawer.DrawString(text)
+
+	width := textWidth(height, text)
+	target := image.Rect(center.X-width/2, center.Y-height/2, center.X-width/2+width, center.Y-height/2+height)
+	xdraw.NearestNeighbor.Scale(img, target, glyphs, glyphs.Bounds(), xdraw.Over, nil)
+}
+
+// Writes the board in the format asked by the route
+func renderBoard(c *gin.Context, format string, pos *position, opts boardOptions) {
+	var buf bytes.Buffer
+
+	contentType := "image/svg+xml"
+	render := writeBoardSVG
+	if format == "png" {
+		contentType, render = "image/png", writeBoardPNG
+	}
+
+	if err := render(&buf, pos, opts); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Data(http.StatusOK, contentType, buf.Bytes())
+}
+
+// Image of a game position, the current one without a ply
+// req = id(from the url), ply, flip, size (from the query)
+func gameBoard(c *gin.Context, format string) {
+	var game Game
+	if !loadVisibleGame(c, &game) {
+		return
+	}
+
+	opts, ok := boardOptionsFrom(c)
+	if !ok {
+		return
+	}
+
+	n, ok := plyFromQuery(c, &game)
+	if !ok {
+		return
+	}
+
+	pos, last, err := positionAt(&game, n)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	opts.highlight(pos, last)
+	renderBoard(c, format, pos, opts)
+}
+
+// Image of any FEN, the position does not have to be legal
+// req = fen, last (the last move in UCI to highlight), flip, size (from the query)
+func fenBoard(c *gin.Context, format string) {
+	fen := c.DefaultQuery("fen", startingFEN)
+	pos, err := parseFEN(fen)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	opts, ok := boardOptionsFrom(c)
+	if !ok {
+		return
+	}
+
+	var last *ply
+	if move := c.Query("last"); move != "" {
+		last = &ply{uci: move}
+	}
+
+	opts.highlight(pos, last)
+	renderBoard(c, format, pos, opts)
+}
+
+// GET
+// Game position as SVG
+func GetBoardSVG(c *gin.Context) {
+	gameBoard(c, "svg")
+}
+
+// GET
+// Game position as PNG
+func GetBoardPNG(c *gin.Context) {
+	gameBoard(c, "png")
+}
+
+// GET
+// Any FEN as SVG
+func RenderFENSVG(c *gin.Context) {
+	fenBoard(c, "svg")
+}
+
+// GET
+// Any FEN as PNG
+func RenderFENPNG(c *gin.Context) {
+	fenBoard(c, "png")
+}
@@ -0,0 +1,129 @@
+package game
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/notnil/chess"
+)
+
+func TestPieceImages(t *testing.T) {
+	if len(pieceImages) != 12 {
+		t.Fatalf("got %d piece images, want 12", len(pieceImages))
+	}
+
+	for piece, img := range pieceImages {
+		bounds := img.Bounds()
+		if bounds.Dx() != 200 || bounds.Dy() != 200 {
+			t.Errorf("%s is %v, want 200x200", piece, bounds)
+		}
+
+		// Transparent around the piece, opaque in the middle
+		if _, _, _, a := img.At(1, 1).RGBA(); a != 0 {
+			t.Errorf("%s has an opaque corner", piece)
+		}
+		if _, _, _, a := img.At(100, 150).RGBA(); a != 0xffff {
+			t.Errorf("%s has a transparent middle", piece)
+		}
+	}
+}
+
+func TestDrawBoard(t *testing.T) {
+	const size = 40
+
+	// Black just played Qh4, the white king is in check on e1
+	pos, err := newPosition("rnb1kbnr/pppp1ppp/8/4p3/6Pq/5P2/PPPPP2P/RNBQKBNR w KQkq - 1 3", variantOf(&Game{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	center := func(col int, row int) image.Point {
+		return image.Pt(col*size+size/2, row*size+size/2)
+	}
+
+	tests := []struct {
+		name  string
+		flip  bool
+		at    image.Point
+		want  color.RGBA
+		piece bool
+	}{
+		{"empty dark square", false, center(3, 2), darkSquare, false},
+		{"empty light square", false, center(4, 2), lightSquare, false},
+		{"last move from an empty square", false, center(3, 0), mixColors(darkSquare, lastMoveColor, 0.2), false},
+		{"corner of the last move's piece", false, image.Pt(7*size+1, 4*size+1), mixColors(darkSquare, lastMoveColor, 0.2), false},
+		{"corner of the king in check", false, image.Pt(4*size+size-2, 7*size+1), mixColors(darkSquare, checkColor, 0.2), false},
+		{"king in check", false, center(4, 7), color.RGBA{}, true},
+		{"flipped empty square", true, center(4, 5), darkSquare, false},
+		{"flipped king", true, center(3, 0), color.RGBA{}, true},
+		{"flipped empty d3", true, center(4, 2), lightSquare, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, err := drawBoard(pos, boardOptions{squareSize: size, flip: tt.flip, lastMove: []chess.Square{chess.D8, chess.H4}, check: chess.E1})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if img.Bounds() != image.Rect(0, 0, 8*size, 8*size) {
+				t.Fatalf("bounds %v, want %d pixels a side", img.Bounds(), 8*size)
+			}
+
+			got := img.RGBAAt(tt.at.X, tt.at.Y)
+			if tt.piece {
+				if got == lightSquare || got == darkSquare || got == mixColors(darkSquare, checkColor, 0.2) {
+					t.Errorf("got the square color %v, want a piece", got)
+				}
+				return
+			}
+			if got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// Rank labels on the left column and file labels on the bottom row, in the
+// color of the other squares
+func TestDrawBoardLabels(t *testing.T) {
+	const size = 90
+
+	pos, err := newPosition("4k3/8/8/8/8/8/8/4K3 w - - 0 1", variantOf(&Game{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := drawBoard(pos, boardOptions{squareSize: size, check: chess.NoSquare})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	inked := func(area image.Rectangle, ink color.RGBA) bool {
+		for y := area.Min.Y; y < area.Max.Y; y++ {
+			for x := area.Min.X; x < area.Max.X; x++ {
+				if img.RGBAAt(x, y) == ink {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	tests := []struct {
+		name string
+		area image.Rectangle
+		ink  color.RGBA
+		want bool
+	}{
+		{"rank 6 on a6", image.Rect(0, 2*size, size/2, 2*size+size/2), darkSquare, true},
+		{"rank 5 on a5", image.Rect(0, 3*size, size/2, 3*size+size/2), lightSquare, true},
+		{"file c on c1", image.Rect(2*size+size/2, 8*size-size/2, 3*size, 8*size), lightSquare, true},
+		{"nothing on c6", image.Rect(2*size, 2*size, 3*size, 3*size), darkSquare, false},
+	}
+
+	for _, tt := range tests {
+		if got := inked(tt.area, tt.ink); got != tt.want {
+			t.Errorf("%s: inked %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
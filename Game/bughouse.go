@@ -0,0 +1,463 @@
+package game
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/notnil/chess"
+	"gorm.io/gorm"
+)
+
+const VariantBughouse = "bughouse"
+
+// Captured pieces are dropped back on the board by the partner of the capturer,
+// squares of promoted pieces are kept in a seventh FEN field ("e8,c1") so they
+// go back to the pocket as pawns
+type bughouseRules struct{ standardRules }
+
+func (bughouseRules) name() string     { return VariantBughouse }
+func (bughouseRules) pgnName() string  { return "Bughouse" }
+func (bughouseRules) startFEN() string { return startingFEN + " -" }
+
+func (bughouseRules) playSpecial(p *position, moveStr string) (*ply, bool, error) {
+	clean := strings.TrimRight(moveStr, "+#")
+	letter, target, isDrop := strings.Cut(clean, "@")
+	if !isDrop {
+		return nil, false, nil
+	}
+
+	pieceType := chess.Pawn
+	if letter != "" && letter != "P" {
+		found := false
+		for t, l := range pieceLetters {
+			if l == letter && t != chess.King {
+				pieceType, found = t, true
+			}
+		}
+		if !found {
+			return nil, true, errInvalidMove
+		}
+	}
+
+	to, ok := parseSquare(target)
+	if !ok {
+		return nil, true, errInvalidMove
+	}
+
+	played, err := p.playDrop(chess.NewPiece(pieceType, p.turn()), to)
+	return played, true, err
+}
+
+// Every drop the pocket allows, only known when the position was loaded from a game
+func (bughouseRules) specialMoves(p *position) []*ply {
+	if !p.tracksPocket {
+		return nil
+	}
+
+	var plies []*ply
+	for _, piece := range pocketPieces(p.pocket, p.turn()) {
+		for sq := chess.A1; sq <= chess.H8; sq++ {
+			if played, err := p.playDrop(piece, sq); err == nil {
+				plies = append(plies, played)
+			}
+		}
+	}
+
+	return plies
+}
+
+func (bughouseRules) afterMove(before *position, after *position, from chess.Square, to chess.Square) {
+	var promoted []string
+	for _, sq := range promotedSquares(before) {
+		if sq != from && sq != to {
+			promoted = append(promoted, sq.String())
+		}
+	}
+	if moved := before.squares[from]; moved.Type() == chess.Pawn && after.squares[to].Type() != chess.Pawn {
+		promoted = append(promoted, to.String())
+	}
+
+	after.extra = []string{orDash(strings.Join(promoted, ","))}
+}
+
+// A partner can always send a piece to block a check from afar or to drop anywhere,
+// so only a check that no piece can block is mate
+func (bughouseRules) canWait(p *position) bool {
+	king, hasKing := kingSquare(p.squares, p.turn())
+
+	for sq := chess.A1; sq <= chess.H8; sq++ {
+		if _, taken := p.occupied(sq); taken {
+			continue
+		}
+		if !hasKing || !p.inCheck() {
+			return true
+		}
+
+		blocked := p.pieces()
+		blocked[sq] = chess.NewPiece(chess.Knight, p.turn())
+		if !squareAttacked(blocked, king, p.turn().Other()) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// More pieces can always arrive
+func (bughouseRules) insufficientMaterialDraws() bool { return false }
+
+// The pockets change with the partner board, so neither the same placement
+// nor a long run without captures means the game is going nowhere
+func (bughouseRules) positionDraws() bool { return false }
+
+func promotedSquares(p *position) []chess.Square {
+	var squares []chess.Square
+	if len(p.extra) == 0 {
+		return squares
+	}
+
+	for _, name := range strings.Split(p.extra[0], ",") {
+		if sq, ok := parseSquare(name); ok {
+			squares = append(squares, sq)
+		}
+	}
+
+	return squares
+}
+
+// Pieces of one color in a pocket, written with FEN letters ("NPp")
+func pocketPieces(pocket string, color chess.Color) []chess.Piece {
+	seen := map[chess.Piece]bool{}
+	var pieces []chess.Piece
+	for _, letter := range pocket {
+		piece := fenPieces[letter]
+		if piece.Color() == color && !seen[piece] {
+			seen[piece] = true
+			pieces = append(pieces, piece)
+		}
+	}
+
+	return pieces
+}
+
+func pocketLetter(piece chess.Piece) string {
+	for letter, p := range fenPieces {
+		if p == piece {
+			return string(letter)
+		}
+	}
+
+	return ""
+}
+
+// Puts a piece from the pocket on an empty square
+func (p *position) playDrop(piece chess.Piece, to chess.Square) (*ply, error) {
+	color := p.turn()
+	letter := pocketLetter(piece)
+
+	if p.tracksPocket && !strings.Contains(p.pocket, letter) {
+		return nil, fmt.Errorf("No %s in your pocket", strings.ToLower(piece.Type().String()))
+	}
+	if _, taken := p.occupied(to); taken {
+		return nil, errIllegalMove
+	}
+	if piece.Type() == chess.Pawn && (to.Rank() == chess.Rank1 || to.Rank() == chess.Rank8) {
+		return nil, errIllegalMove
+	}
+
+	next := *p
+	next.squares = p.pieces()
+	next.squares[to] = piece
+	next.color = color.Other()
+	next.enPassant = chess.NoSquare
+	next.halfMoves++
+	if piece.Type() == chess.Pawn {
+		next.halfMoves = 0
+	}
+	if color == chess.Black {
+		next.fullMoves++
+	}
+	next.pocket = strings.Replace(p.pocket, letter, "", 1)
+
+	// A drop can't leave the own king in check
+	if king, ok := kingSquare(next.squares, color); ok && squareAttacked(next.squares, king, color.Other()) {
+		return nil, errIllegalMove
+	}
+
+	after, err := newPosition(next.encode(), p.rules)
+	if err != nil {
+		return nil, err
+	}
+	after.pocket, after.tracksPocket = next.pocket, p.tracksPocket
+
+	name := strings.ToUpper(letter)
+	if name == "" {
+		name = "P"
+	}
+	san := name + "@" + to.String()
+	check := ""
+	if after.inCheck() {
+		check = "+"
+		if !after.hasLegalMove() && !after.rules.canWait(after) {
+			check = "#"
+		}
+	}
+
+	return &ply{
+		before: p,
+		after:  after,
+		san:    san + check,
+		uci:    san,
+		lan:    san + check,
+	}, nil
+}
+
+// Piece taken by a move, promoted pieces count as pawns
+func capturedPiece(played *ply) (chess.Piece, bool) {
+	before, after := played.before, played.after
+	opponent := before.turn().Other()
+
+	for sq, piece := range before.squares {
+		if piece == chess.NoPiece || piece.Color() != opponent || after.squares[sq] == piece {
+			continue
+		}
+
+		for _, promoted := range promotedSquares(before) {
+			if promoted == sq {
+				return chess.NewPiece(chess.Pawn, opponent), true
+			}
+		}
+		return piece, true
+	}
+
+	return chess.NoPiece, false
+}
+
+// Moves the pieces of a bughouse move between the pockets: a drop leaves the
+// mover's pocket and a capture goes to the partner, who plays the other color
+// both are changed in SQL so a piece the partner board sends at the same time is kept
+func updatePockets(tx *gorm.DB, game *Game, played *ply) error {
+	if _, target, isDrop := strings.Cut(played.uci, "@"); isDrop {
+		to, _ := parseSquare(target)
+		letter := pocketLetter(played.after.squares[to])
+
+		// Only the first one of the dropped piece is taken out
+		if err := tx.Model(&Game{}).Where("id = ?", game.ID).
+			Update("pocket", gorm.Expr("substr(pocket, 1, instr(pocket, ?) - 1) || substr(pocket, instr(pocket, ?) + 1)", letter, letter)).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&Game{}).Where("id = ?", game.ID).Select("pocket").Scan(&game.Pocket).Error; err != nil {
+			return err
+		}
+	}
+
+	piece, ok := capturedPiece(played)
+	if !ok {
+		return nil
+	}
+
+	return tx.Model(&Game{}).Where("id = ?", game.PartnerGameID).
+		Update("pocket", gorm.Expr("COALESCE(pocket, '') || ?", pocketLetter(piece))).Error
+}
+
+// Result of the partner board when one board ends: the same team wins,
+// and white on one board is the partner of black on the other
+func partnerResult(result string) string {
+	switch result {
+	case WhiteWins:
+		return BlackWins
+	case BlackWins:
+		return WhiteWins
+	}
+
+	return result
+}
+
+// Ends the partner board the same way, the match ends with either board
+// a partner board moved in the meantime is loaded again
+func endPartnerGame(game *Game, now time.Time) {
+	if game.PartnerGameID == "" || game.Termination == TerminationPartnerGame {
+		return
+	}
+
+	for attempt := 0; attempt < 3; attempt++ {
+		var partner Game
+		if err := db.First(&partner, "id = ?", game.PartnerGameID).Error; err != nil {
+			return
+		}
+
+		switch game.Status {
+		case StatusFinished:
+			if partner.Status != StatusOngoing {
+				return
+			}
+			stopClock(&partner, now)
+			if err := finishGame(&partner, partnerResult(game.Result), TerminationPartnerGame, now); err != nil {
+				return
+			}
+		case StatusAborted:
+			if partner.transition(StatusAborted) != nil {
+				return
+			}
+			partner.EndTime = now
+		default:
+			return
+		}
+
+		err := updateGame(&partner)
+		if err == nil {
+			publishGame(&partner, "end", "", now)
+			return
+		}
+		if err != errGameChanged {
+			log.Printf("failed to end the partner board of game %s: %v", game.ID, err)
+			return
+		}
+	}
+}
+
+// POST
+// Create a bughouse match: two linked boards for two teams of two
+// req = team1, team2 (account ids, the first player of each team plays the first board), time_control
+func CreateBughouse(c *gin.Context) {
+	var input struct {
+		Team1       []string `json:"team1"`
+		Team2       []string `json:"team2"`
+		TimeControl string   `json:"time_control"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if len(input.Team1) != 2 || len(input.Team2) != 2 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Each team needs exactly two players"})
+		return
+	}
+
+	players := append(append([]string{}, input.Team1...), input.Team2...)
+	seen := map[string]bool{}
+	for _, player := range players {
+		if player == "" || seen[player] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Bughouse needs four different players"})
+			return
+		}
+		seen[player] = true
+	}
+
+	var ongoingGame Game
+	if err := db.Where("status = ? AND (white_player_id IN ? OR black_player_id IN ?)", StatusOngoing, players, players).First(&ongoingGame).Error; err == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "One of the players is already in an ongoing game"})
+		return
+	}
+
+	timeControl, err := ParseTimeControl(input.TimeControl)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	matchID := uuid.New().String()
+	fen := variants[VariantBughouse].startFEN()
+
+	// Team 1 plays white on the first board and black on the second
+	board := func(number int, whiteID string, blackID string) Game {
+		return Game{
+			ID:             uuid.New().String(),
+			WhitePlayerID:  whiteID,
+			BlackPlayerID:  blackID,
+			StartTime:      now,
+			GameType:       timeControl.Category(),
+			GameTime:       timeControl.BaseSeconds,
+			TimeControl:    timeControl,
+			Status:         StatusCreated,
+			WhiteClock:     int64(timeControl.BaseSeconds) * 1000,
+			BlackClock:     int64(timeControl.BaseSeconds) * 1000,
+			Variant:        VariantBughouse,
+			StartFEN:       fen,
+			FEN:            fen,
+			PositionHashes: StringArray{positionHash(fen)},
+			BughouseID:     matchID,
+			BughouseBoard:  number,
+		}
+	}
+	boards := []Game{board(1, input.Team1[0], input.Team2[0]), board(2, input.Team2[1], input.Team1[1])}
+	boards[0].PartnerGameID, boards[1].PartnerGameID = boards[1].ID, boards[0].ID
+
+	for i := range boards {
+		if err := boards[i].transition(StatusOngoing); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if err := db.Create(&boards).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	for i := range boards {
+		scheduleFlag(&boards[i], time.Now())
+		announceGame(&boards[i])
+	}
+
+	c.JSON(http.StatusOK, gin.H{"bughouse_id": matchID, "boards": boards})
+}
+
+// GET
+// Both boards of a bughouse match with their pockets and clocks
+func GetBughouse(c *gin.Context) {
+	var ids []string
+	if err := db.Model(&Game{}).Where("bughouse_id = ?", c.Param("id")).Order("bughouse_board").Pluck("id", &ids).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if len(ids) != 2 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Bughouse match not found"})
+		return
+	}
+
+	now := time.Now()
+	states := make([]gin.H, 0, len(ids))
+	for _, id := range ids {
+		// Loaded one at a time, a flag on the first board also ends the second
+		var board Game
+		if err := db.First(&board, "id = ?", id).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		if _, err := saveFlag(&board, now); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		states = append(states, gin.H{
+			"game":         board,
+			"clocks":       clocksResponse(&board, now),
+			"white_pocket": pocketOf(board.Pocket, chess.White),
+			"black_pocket": pocketOf(board.Pocket, chess.Black),
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"bughouse_id": c.Param("id"), "boards": states})
+}
+
+// Pieces of one color in a pocket, upper case whatever the color
+func pocketOf(pocket string, color chess.Color) string {
+	pieces := ""
+	for _, letter := range pocket {
+		if piece, ok := fenPieces[letter]; ok && piece.Color() == color {
+			pieces += strings.ToUpper(string(letter))
+		}
+	}
+
+	return pieces
+}
@@ -0,0 +1,151 @@
+package game
+
+import (
+	"testing"
+
+	"github.com/notnil/chess"
+)
+
+// Plays a move from a bughouse FEN, the pocket is only checked when given
+func bughousePly(t *testing.T, fen string, pocket string, move string) *ply {
+	t.Helper()
+
+	pos, err := newPosition(fen, bughouseRules{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pos.pocket, pos.tracksPocket = pocket, pocket != ""
+
+	played, err := pos.play(move, "")
+	if err != nil {
+		t.Fatalf("%s: %v", move, err)
+	}
+
+	return played
+}
+
+func TestCapturedPiece(t *testing.T) {
+	tests := []struct {
+		name   string
+		fen    string
+		move   string
+		want   chess.Piece
+		wantOK bool
+	}{
+		{"quiet move", startingFEN + " -", "e4", chess.NoPiece, false},
+		{"drop", startingFEN + " -", "N@e4", chess.NoPiece, false},
+		{"pawn", "rnbqkbnr/pppp1ppp/8/4p3/3P4/8/PPP1PPPP/RNBQKBNR w KQkq - 0 2 -", "dxe5", chess.BlackPawn, true},
+		{"knight", "4k3/8/8/3n4/8/4N3/8/4K3 w - - 0 1 -", "Nxd5", chess.BlackKnight, true},
+		{"en passant", "4k3/8/8/3pP3/8/8/8/4K3 w - d6 0 2 -", "exd6", chess.BlackPawn, true},
+		{"promoted queen goes back as a pawn", "q3k3/8/8/8/8/8/8/R3K3 w - - 0 1 a8", "Rxa8+", chess.BlackPawn, true},
+		{"by black", "4k3/8/8/3n4/8/4N3/8/4K3 b - - 0 1 -", "Nxe3", chess.WhiteKnight, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := capturedPiece(bughousePly(t, tt.fen, "", tt.move))
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("got %v %v, want %v %v", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestUpdatePockets(t *testing.T) {
+	tests := []struct {
+		name        string
+		fen         string
+		pocket      string
+		move        string
+		wantPocket  string
+		wantPartner string
+	}{
+		{"quiet move", startingFEN + " -", "N", "e4", "N", "Q"},
+		{"drop takes the first one out", startingFEN + " -", "NPN", "N@e4", "PN", "Q"},
+		{"capture goes to the partner", "rnbqkbnr/pppp1ppp/8/4p3/3P4/8/PPP1PPPP/RNBQKBNR w KQkq - 0 2 -", "N", "dxe5", "N", "Qp"},
+		{"captured promoted piece goes as a pawn", "q3k3/8/8/8/8/8/8/R3K3 w - - 0 1 a8", "N", "Rxa8+", "N", "Qp"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testDB(t)
+
+			game := Game{ID: "board1", PartnerGameID: "board2", BughouseID: "match", Status: StatusOngoing, Variant: VariantBughouse, FEN: tt.fen, Pocket: tt.pocket}
+			partner := Game{ID: "board2", PartnerGameID: "board1", BughouseID: "match", Status: StatusOngoing, Variant: VariantBughouse, FEN: startingFEN + " -", Pocket: "Q"}
+			if err := db.Create(&[]Game{game, partner}).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			if err := updatePockets(db, &game, bughousePly(t, tt.fen, tt.pocket, tt.move)); err != nil {
+				t.Fatal(err)
+			}
+
+			var saved []Game
+			if err := db.Order("id").Find(&saved).Error; err != nil {
+				t.Fatal(err)
+			}
+			if saved[0].Pocket != tt.wantPocket || saved[1].Pocket != tt.wantPartner {
+				t.Errorf("pockets %q and %q, want %q and %q", saved[0].Pocket, saved[1].Pocket, tt.wantPocket, tt.wantPartner)
+			}
+			if game.Pocket != tt.wantPocket {
+				t.Errorf("pocket of the loaded game %q, want %q", game.Pocket, tt.wantPocket)
+			}
+		})
+	}
+}
+
+func TestBughouseCanWait(t *testing.T) {
+	tests := []struct {
+		name string
+		fen  string
+		want bool
+	}{
+		{"not in check", "7k/5Q2/6K1/8/8/8/8/8 b - - 0 1 -", true},
+		{"check from afar", "k7/8/8/8/8/8/8/R6K b - - 0 1 -", true},
+		{"check from a touching queen", "7k/6Q1/5K2/8/8/8/8/8 b - - 0 1 -", false},
+		{"check from a knight", "7k/5N2/8/8/8/8/8/K7 b - - 0 1 -", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pos, err := newPosition(tt.fen, bughouseRules{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := pos.rules.canWait(pos); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// The pockets are not in the key of a position, so bughouse has no draw
+// by repetition or by moves without a capture
+func TestBughouseHasNoPositionDraws(t *testing.T) {
+	fen := "4k3/8/8/8/8/8/8/R3K3 w - - 100 80"
+
+	tests := []struct {
+		variant string
+		fen     string
+		want    string
+	}{
+		{VariantStandard, fen, TerminationFivefoldRepetition},
+		{VariantBughouse, fen + " -", ""},
+	}
+
+	for _, tt := range tests {
+		game := &Game{Variant: tt.variant}
+		pos, err := newPosition(tt.fen, variantOf(game))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Seen five times, a hundred plies after the last capture
+		for i := 0; i < 5; i++ {
+			game.PositionHashes = append(game.PositionHashes, positionHash(pos.fen))
+		}
+
+		if _, termination := detectOutcome(game, pos); termination != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.variant, termination, tt.want)
+		}
+	}
+}
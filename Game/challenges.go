@@ -0,0 +1,425 @@
+package game
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"os"
+	"time"
+
+	account "project/Account"
+	events "project/Events"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultChallengeExpiry = time.Hour
+	maxDeclineReason       = 200
+)
+
+// How long a challenge waits for an answer, CHALLENGE_EXPIRY is a
+// Go duration like "30m" or "24h"
+func challengeExpiry() time.Duration {
+	expiry, err := time.ParseDuration(os.Getenv("CHALLENGE_EXPIRY"))
+	if err != nil || expiry <= 0 {
+		return defaultChallengeExpiry
+	}
+
+	return expiry
+}
+
+// Challenges are expired when they are read instead of by a worker
+func expireChallenges(now time.Time) {
+	db.Model(&Challenge{}).Where("status = ? AND expires_at <= ?", ChallengePending, now).Update("status", ChallengeExpired)
+}
+
+func (ch *Challenge) options() gameOptions {
+	return gameOptions{TimeControl: ch.TimeControl, Rated: ch.Rated, Variant: ch.Variant, FEN: ch.FEN, Private: ch.Private, DaysPerMove: ch.DaysPerMove}
+}
+
+// Moves a pending challenge to another status, fails if it was answered meanwhile
+func answerChallenge(ch *Challenge, status string, fields map[string]interface{}) error {
+	updates := map[string]interface{}{"status": status}
+	for key, value := range fields {
+		updates[key] = value
+	}
+
+	result := db.Model(&Challenge{}).Where("id = ? AND status = ?", ch.ID, ChallengePending).Updates(updates)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("Challenge is no longer pending")
+	}
+
+	ch.Status = status
+	return nil
+}
+
+// Pending challenge of the url, for the challenger or the opponent
+func loadChallenge(c *gin.Context, role string) (*Challenge, bool) {
+	accountID, ID_exists := c.Get("accountID")
+	if !ID_exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return nil, false
+	}
+
+	expireChallenges(time.Now())
+
+	var ch Challenge
+	if err := db.First(&ch, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Challenge not found"})
+		return nil, false
+	}
+
+	allowed := ch.OpponentID == accountID.(string)
+	if role == "challenger" {
+		allowed = ch.ChallengerID == accountID.(string)
+	}
+	if !allowed {
+		c.JSON(http.StatusForbidden, gin.H{"error": "This challenge is not yours to answer"})
+		return nil, false
+	}
+
+	if ch.Status != ChallengePending {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Challenge is " + ch.Status})
+		return nil, false
+	}
+
+	return &ch, true
+}
+
+// POST
+// Challenge a player by username
+// req = username, time_control, color (yours: white, black or random), rated (true by default), variant, fen (for from_position), private, days_per_move (instead of time_control)
+func CreateChallenge(c *gin.Context) {
+	createChallenge(c, false)
+}
+
+// POST
+// Open challenge link, claimed by the first player who opens it
+// or only by the player named with username
+// req = username (optional), time_control, color, rated, variant, fen, private, days_per_move
+// returns the challenge with its token and the link to share
+func CreateOpenChallenge(c *gin.Context) {
+	createChallenge(c, true)
+}
+
+func createChallenge(c *gin.Context, open bool) {
+	accountID, ID_exists := c.Get("accountID")
+	if !ID_exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var input struct {
+		Username    string `json:"username"`
+		TimeControl string `json:"time_control"`
+		Color       string `json:"color"`
+		Rated       *bool  `json:"rated"`
+		Variant     string `json:"variant"`
+		FEN         string `json:"fen"`
+		Private     bool   `json:"private"`
+		DaysPerMove int    `json:"days_per_move"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if input.Username == "" && !open {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Username is required"})
+		return
+	}
+
+	var challenger, opponent account.Account
+	if err := db.First(&challenger, "id = ?", accountID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+		return
+	}
+	if input.Username != "" {
+		if err := db.First(&opponent, "username = ?", input.Username).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+	}
+
+	var timeControl TimeControl
+	var err error
+	if input.DaysPerMove == 0 {
+		if timeControl, err = ParseTimeControl(input.TimeControl); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if input.Color == "" {
+		input.Color = "random"
+	}
+
+	now := time.Now()
+	ch := Challenge{
+		ID:             uuid.New().String(),
+		ChallengerID:   challenger.ID,
+		ChallengerName: challenger.Username,
+		OpponentID:     opponent.ID,
+		OpponentName:   opponent.Username,
+		TimeControl:    timeControl,
+		Variant:        input.Variant,
+		FEN:            input.FEN,
+		Rated:          input.Rated == nil || *input.Rated,
+		Color:          input.Color,
+		Private:        input.Private,
+		DaysPerMove:    input.DaysPerMove,
+		Status:         ChallengePending,
+		CreatedAt:      now,
+		ExpiresAt:      now.Add(challengeExpiry()),
+	}
+
+	if open {
+		if ch.Token, err = challengeToken(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	// Checked now with the rules of CreateGame so a bad challenge is never sent
+	whiteID, blackID, err := assignColors(ch.ChallengerID, ch.OpponentID, ch.Color)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if _, err := buildGame(whiteID, blackID, ch.options()); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := db.Create(&ch).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if ch.OpponentID != "" {
+		events.Publish(ch.OpponentID, events.TypeChallenge, ch)
+	}
+
+	response := gin.H{"challenge": ch}
+	if open {
+		response["link"] = "/challenges/open/" + ch.Token
+	}
+	c.JSON(http.StatusCreated, response)
+}
+
+// Random token of an open challenge, hard to guess since it is all it takes to claim it
+func challengeToken() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(buf), nil
+}
+
+// GET
+// Pending challenges sent to you
+func GetIncomingChallenges(c *gin.Context) {
+	listChallenges(c, "opponent_id")
+}
+
+// GET
+// Pending challenges you sent
+func GetOutgoingChallenges(c *gin.Context) {
+	listChallenges(c, "challenger_id")
+}
+
+func listChallenges(c *gin.Context, column string) {
+	accountID, ID_exists := c.Get("accountID")
+	if !ID_exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	expireChallenges(time.Now())
+
+	var challenges []Challenge
+	if err := db.Where(column+" = ? AND status = ?", accountID, ChallengePending).Order("created_at").Find(&challenges).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"challenges": challenges})
+}
+
+// POST
+// Accept a challenge sent to you, the game starts right away
+// req = id(from the url)
+func AcceptChallenge(c *gin.Context) {
+	ch, ok := loadChallenge(c, "opponent")
+	if !ok {
+		return
+	}
+
+	startChallenge(c, ch, false)
+}
+
+// Creates the game of a challenge whose opponent is known,
+// claimed when the opponent just claimed an open link
+func startChallenge(c *gin.Context, ch *Challenge, claimed bool) {
+	whiteID, blackID, err := assignColors(ch.ChallengerID, ch.OpponentID, ch.Color)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	newGame, err := buildGame(whiteID, blackID, ch.options())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Claimed first so a second accept can't start another game,
+	// the opponent is saved too for an open link
+	claim := map[string]interface{}{"game_id": newGame.ID, "opponent_id": ch.OpponentID, "opponent_name": ch.OpponentName}
+	if err := answerChallenge(ch, ChallengeAccepted, claim); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if status, err := startGame(newGame); err != nil {
+		// An open link can be claimed again
+		reopen := map[string]interface{}{"status": ChallengePending, "game_id": ""}
+		if claimed {
+			reopen["opponent_id"], reopen["opponent_name"] = "", ""
+		}
+		db.Model(&Challenge{}).Where("id = ?", ch.ID).Updates(reopen)
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+	ch.GameID = newGame.ID
+
+	c.JSON(http.StatusOK, gin.H{"challenge": ch, "game": newGame})
+}
+
+// POST
+// Decline a challenge sent to you
+// req = id(from the url), reason (optional)
+func DeclineChallenge(c *gin.Context) {
+	ch, ok := loadChallenge(c, "opponent")
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Reason string `json:"reason"`
+	}
+	// The body is optional
+	_ = c.ShouldBindJSON(&input)
+
+	if len(input.Reason) > maxDeclineReason {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Reason is too long"})
+		return
+	}
+
+	if err := answerChallenge(ch, ChallengeDeclined, map[string]interface{}{"decline_reason": input.Reason}); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ch.DeclineReason = input.Reason
+
+	events.Publish(ch.ChallengerID, events.TypeChallengeDeclined, ch)
+
+	c.JSON(http.StatusOK, gin.H{"challenge": ch})
+}
+
+// DELETE
+// Cancel a challenge you sent
+// req = id(from the url)
+func CancelChallenge(c *gin.Context) {
+	ch, ok := loadChallenge(c, "challenger")
+	if !ok {
+		return
+	}
+
+	if err := answerChallenge(ch, ChallengeCancelled, nil); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// An open link nobody claimed has no opponent to tell
+	if ch.OpponentID != "" {
+		events.Publish(ch.OpponentID, events.TypeChallengeCancelled, ch)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Challenge cancelled"})
+}
+
+// Challenge of the open link in the url
+func loadOpenChallenge(c *gin.Context) (*Challenge, bool) {
+	expireChallenges(time.Now())
+
+	var ch Challenge
+	if err := db.First(&ch, "token = ? AND token <> ''", c.Param("token")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Challenge not found"})
+		return nil, false
+	}
+
+	return &ch, true
+}
+
+// GET
+// Challenge behind an open link, to see it before claiming it
+// req = token(from the url)
+func GetOpenChallenge(c *gin.Context) {
+	ch, ok := loadOpenChallenge(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"challenge": ch})
+}
+
+// POST
+// Claim an open link: you become the opponent and the game starts
+// req = token(from the url)
+func ClaimOpenChallenge(c *gin.Context) {
+	accountID, ID_exists := c.Get("accountID")
+	if !ID_exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	ch, ok := loadOpenChallenge(c)
+	if !ok {
+		return
+	}
+
+	if ch.Status != ChallengePending {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Challenge is " + ch.Status})
+		return
+	}
+
+	if ch.ChallengerID == accountID.(string) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You can't claim your own challenge"})
+		return
+	}
+
+	// A link naming its opponent can only be claimed by them
+	claimed := ch.OpponentID == ""
+	if !claimed && ch.OpponentID != accountID.(string) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "This challenge is for another player"})
+		return
+	}
+
+	if claimed {
+		var opponent account.Account
+		if err := db.First(&opponent, "id = ?", accountID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+			return
+		}
+		ch.OpponentID, ch.OpponentName = opponent.ID, opponent.Username
+	}
+
+	startChallenge(c, ch, claimed)
+}
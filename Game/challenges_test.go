@@ -0,0 +1,140 @@
+package game
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestClaimOpenChallenge(t *testing.T) {
+	tests := []struct {
+		name       string
+		opponentID string
+		status     string
+		expired    bool
+		claimer    string
+		token      string
+		wantCode   int
+	}{
+		{"open link", "", ChallengePending, false, "bob", "link", http.StatusOK},
+		{"link naming the claimer", "bob", ChallengePending, false, "bob", "link", http.StatusOK},
+		{"link naming another player", "carol", ChallengePending, false, "bob", "link", http.StatusForbidden},
+		{"own link", "", ChallengePending, false, "alice", "link", http.StatusBadRequest},
+		{"already accepted", "", ChallengeAccepted, false, "bob", "link", http.StatusBadRequest},
+		{"cancelled", "", ChallengeCancelled, false, "bob", "link", http.StatusBadRequest},
+		{"expired", "", ChallengePending, true, "bob", "link", http.StatusBadRequest},
+		{"unknown token", "", ChallengePending, false, "bob", "other", http.StatusNotFound},
+		{"unknown claimer", "", ChallengePending, false, "dave", "link", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testDB(t)
+			createAccounts(t, "alice", "bob", "carol")
+
+			expires := time.Now().Add(time.Hour)
+			if tt.expired {
+				expires = time.Now().Add(-time.Minute)
+			}
+			ch := Challenge{ID: "ch", ChallengerID: "alice", ChallengerName: "alice", OpponentID: tt.opponentID, OpponentName: tt.opponentID, TimeControl: TimeControl{BaseSeconds: 180, IncrementSeconds: 2}, Variant: VariantStandard, Color: "white", Token: "link", Status: tt.status, ExpiresAt: expires}
+			if err := db.Create(&ch).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			w := apiRequest(http.MethodPost, "/challenges/open/"+tt.token, tt.claimer, "")
+			if w.Code != tt.wantCode {
+				t.Fatalf("got %d %s, want %d", w.Code, w.Body.String(), tt.wantCode)
+			}
+
+			var saved Challenge
+			if err := db.First(&saved, "id = ?", "ch").Error; err != nil {
+				t.Fatal(err)
+			}
+			var games int64
+			db.Model(&Game{}).Count(&games)
+
+			if tt.wantCode != http.StatusOK {
+				if games != 0 || saved.OpponentID != tt.opponentID {
+					t.Errorf("%d games and opponent %q, want no game and the challenge untouched", games, saved.OpponentID)
+				}
+				return
+			}
+
+			var started Game
+			if err := db.First(&started, "id = ?", saved.GameID).Error; err != nil {
+				t.Fatalf("game of the challenge: %v", err)
+			}
+			if saved.Status != ChallengeAccepted || saved.OpponentID != tt.claimer || saved.OpponentName != tt.claimer {
+				t.Errorf("challenge %s with opponent %q %q, want accepted by %s", saved.Status, saved.OpponentID, saved.OpponentName, tt.claimer)
+			}
+			if started.WhitePlayerID != "alice" || started.BlackPlayerID != tt.claimer || started.Status != StatusOngoing {
+				t.Errorf("game %s between %s and %s, want ongoing between alice and %s", started.Status, started.WhitePlayerID, started.BlackPlayerID, tt.claimer)
+			}
+		})
+	}
+}
+
+// The link is gone once claimed, by the same player or another one
+func TestClaimOpenChallengeOnlyOnce(t *testing.T) {
+	testDB(t)
+	createAccounts(t, "alice", "bob", "carol")
+
+	ch := Challenge{ID: "ch", ChallengerID: "alice", ChallengerName: "alice", TimeControl: TimeControl{BaseSeconds: 180}, Variant: VariantStandard, Color: "random", Token: "link", Status: ChallengePending, ExpiresAt: time.Now().Add(time.Hour)}
+	if err := db.Create(&ch).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if w := apiRequest(http.MethodPost, "/challenges/open/link", "bob", ""); w.Code != http.StatusOK {
+		t.Fatalf("first claim: got %d %s", w.Code, w.Body.String())
+	}
+	for _, claimer := range []string{"bob", "carol"} {
+		if w := apiRequest(http.MethodPost, "/challenges/open/link", claimer, ""); w.Code != http.StatusBadRequest {
+			t.Errorf("claim again by %s: got %d %s, want %d", claimer, w.Code, w.Body.String(), http.StatusBadRequest)
+		}
+	}
+
+	var games int64
+	db.Model(&Game{}).Count(&games)
+	if games != 1 {
+		t.Errorf("got %d games, want 1", games)
+	}
+}
+
+func TestAcceptChallenge(t *testing.T) {
+	tests := []struct {
+		name     string
+		accepter string
+		status   string
+		wantCode int
+	}{
+		{"by the opponent", "bob", ChallengePending, http.StatusOK},
+		{"by the challenger", "alice", ChallengePending, http.StatusForbidden},
+		{"by another player", "carol", ChallengePending, http.StatusForbidden},
+		{"declined", "bob", ChallengeDeclined, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testDB(t)
+			createAccounts(t, "alice", "bob", "carol")
+
+			ch := Challenge{ID: "ch", ChallengerID: "alice", OpponentID: "bob", TimeControl: TimeControl{BaseSeconds: 180}, Variant: VariantStandard, Color: "black", Status: tt.status, ExpiresAt: time.Now().Add(time.Hour)}
+			if err := db.Create(&ch).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			w := apiRequest(http.MethodPost, "/challenges/ch/accept", tt.accepter, "")
+			if w.Code != tt.wantCode {
+				t.Fatalf("got %d %s, want %d", w.Code, w.Body.String(), tt.wantCode)
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+
+			var started Game
+			if err := db.First(&started, "white_player_id = ? AND black_player_id = ?", "bob", "alice").Error; err != nil {
+				t.Errorf("game with bob as white: %v", err)
+			}
+		})
+	}
+}
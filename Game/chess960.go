@@ -0,0 +1,310 @@
+package game
+
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+
+	"github.com/notnil/chess"
+)
+
+const standardChess960ID = 518
+
+// Knight squares among the five empty ones, indexed by what is left of the ID
+var chess960Knights = [10][2]int{{0, 1}, {0, 2}, {0, 3}, {0, 4}, {1, 2}, {1, 3}, {1, 4}, {2, 3}, {2, 4}, {3, 4}}
+
+func randomChess960ID() int {
+	return rand.Intn(960)
+}
+
+// Starting FEN of a Chess960 position from its Scharnagl number (518 is the standard position)
+func chess960FEN(id int) (string, error) {
+	if id < 0 || id > 959 {
+		return "", fmt.Errorf("Chess960 position must be between 0 and 959")
+	}
+
+	var row [8]byte
+	place := func(piece byte, nth int) {
+		for file := range row {
+			if row[file] != 0 {
+				continue
+			}
+			if nth == 0 {
+				row[file] = piece
+				return
+			}
+			nth--
+		}
+	}
+
+	n := id
+	row[2*(n%4)+1] = 'B'
+	n /= 4
+	row[2*(n%4)] = 'B'
+	n /= 4
+	place('Q', n%6)
+	n /= 6
+
+	// The second knight goes on the empty squares left after the first
+	knights := chess960Knights[n]
+	place('N', knights[0])
+	place('N', knights[1]-1)
+
+	place('R', 0)
+	place('K', 0)
+	place('R', 0)
+
+	back := string(row[:])
+
+	// Castling rights as rook files, king side first
+	kingSide := strings.ToUpper(string(rune('a' + strings.LastIndexByte(back, 'R'))))
+	queenSide := strings.ToUpper(string(rune('a' + strings.IndexByte(back, 'R'))))
+	castling := kingSide + queenSide + strings.ToLower(kingSide+queenSide)
+
+	return fmt.Sprintf("%s/pppppppp/8/8/8/8/PPPPPPPP/%s w %s - 0 1", strings.ToLower(back), back, castling), nil
+}
+
+// A castling move of a Chess960 game
+type castle struct {
+	side   chess.Side
+	king   chess.Square
+	rook   chess.Square
+	kingTo chess.Square
+	rookTo chess.Square
+}
+
+func backRank(color chess.Color) chess.Rank {
+	if color == chess.Black {
+		return chess.Rank8
+	}
+
+	return chess.Rank1
+}
+
+// Files of the rooks that can still castle
+func castlingFiles(castling string, color chess.Color) []chess.File {
+	var files []chess.File
+	for _, letter := range castling {
+		if letter >= 'A' && letter <= 'H' && color == chess.White {
+			files = append(files, chess.File(letter-'A'))
+		}
+		if letter >= 'a' && letter <= 'h' && color == chess.Black {
+			files = append(files, chess.File(letter-'a'))
+		}
+	}
+
+	return files
+}
+
+// Castling moves the side to move can play now
+func (p *position) castles960() []castle {
+	if p.inCheck() {
+		return nil
+	}
+
+	color := p.turn()
+	rank := backRank(color)
+	pieces := p.pieces()
+
+	king, ok := kingSquare(pieces, color)
+	if !ok || king.Rank() != rank {
+		return nil
+	}
+
+	var castles []castle
+	for _, file := range castlingFiles(p.rights, color) {
+		rook := chess.NewSquare(file, rank)
+		if pieces[rook] != chess.NewPiece(chess.Rook, color) {
+			continue
+		}
+
+		c := castle{side: chess.QueenSide, king: king, rook: rook}
+		c.kingTo, c.rookTo = chess.NewSquare(chess.FileC, rank), chess.NewSquare(chess.FileD, rank)
+		if file > king.File() {
+			c.side = chess.KingSide
+			c.kingTo, c.rookTo = chess.NewSquare(chess.FileG, rank), chess.NewSquare(chess.FileF, rank)
+		}
+
+		if p.canCastle(pieces, c) {
+			castles = append(castles, c)
+		}
+	}
+
+	return castles
+}
+
+// Squares between the king, the rook and their targets must be empty
+// and the king can't pass through an attacked square
+func (p *position) canCastle(pieces map[chess.Square]chess.Piece, c castle) bool {
+	without := make(map[chess.Square]chess.Piece, len(pieces))
+	for sq, piece := range pieces {
+		if sq != c.king && sq != c.rook {
+			without[sq] = piece
+		}
+	}
+
+	files := []chess.File{c.king.File(), c.rook.File(), c.kingTo.File(), c.rookTo.File()}
+	low, high := files[0], files[0]
+	for _, file := range files {
+		low, high = min(low, file), max(high, file)
+	}
+
+	rank := c.king.Rank()
+	for file := low; file <= high; file++ {
+		if piece, ok := without[chess.NewSquare(file, rank)]; ok && piece != chess.NoPiece {
+			return false
+		}
+	}
+
+	step := chess.File(1)
+	if c.kingTo.File() < c.king.File() {
+		step = -1
+	}
+	for file := c.king.File(); ; file += step {
+		if squareAttacked(without, chess.NewSquare(file, rank), p.turn().Other()) {
+			return false
+		}
+		if file == c.kingTo.File() {
+			break
+		}
+	}
+
+	return true
+}
+
+// Plays "O-O", "O-O-O" or a king taking its own rook (UCI) in a Chess960 game
+// ok is false when the move is not a castling move
+func (p *position) castle960(moveStr string) (*ply, bool, error) {
+	clean := strings.TrimRight(moveStr, "+#")
+
+	var side chess.Side
+	switch clean {
+	case "O-O", "0-0":
+		side = chess.KingSide
+	case "O-O-O", "0-0-0":
+		side = chess.QueenSide
+	default:
+		// UCI castling in Chess960 is written as the king taking its rook
+		if len(clean) != 4 {
+			return nil, false, nil
+		}
+
+		pieces := p.pieces()
+		from, fromOK := parseSquare(clean[:2])
+		to, toOK := parseSquare(clean[2:])
+		if !fromOK || !toOK || pieces[from] != chess.NewPiece(chess.King, p.turn()) || pieces[to] != chess.NewPiece(chess.Rook, p.turn()) {
+			return nil, false, nil
+		}
+
+		side = chess.QueenSide
+		if to.File() > from.File() {
+			side = chess.KingSide
+		}
+	}
+
+	for _, c := range p.castles960() {
+		if c.side == side {
+			played, err := p.playCastle(c)
+			return played, true, err
+		}
+	}
+
+	return nil, true, errIllegalMove
+}
+
+func (p *position) playCastle(c castle) (*ply, error) {
+	color := p.turn()
+
+	pieces := p.pieces()
+	delete(pieces, c.king)
+	delete(pieces, c.rook)
+	pieces[c.kingTo] = chess.NewPiece(chess.King, color)
+	pieces[c.rookTo] = chess.NewPiece(chess.Rook, color)
+
+	// The mover loses both rights, the opponent keeps theirs
+	castling := ""
+	for _, letter := range p.rights {
+		if (letter >= 'a') != (color == chess.Black) {
+			castling += string(letter)
+		}
+	}
+
+	halfMoves, fullMoves := p.halfMoves, p.fullMoves
+	if color == chess.Black {
+		fullMoves++
+	}
+
+	fen := fmt.Sprintf("%s %s %s - %d %d", chess.NewBoard(pieces).String(), color.Other().String(), orDash(castling), halfMoves+1, fullMoves)
+
+	after, err := newPosition(fen, p.rules)
+	if err != nil {
+		return nil, err
+	}
+
+	san := "O-O-O"
+	if c.side == chess.KingSide {
+		san = "O-O"
+	}
+	if after.inCheck() {
+		if after.hasLegalMove() {
+			san += "+"
+		} else {
+			san += "#"
+		}
+	}
+
+	return &ply{
+		before: p,
+		after:  after,
+		san:    san,
+		uci:    c.king.String() + c.rook.String(),
+		lan:    san,
+	}, nil
+}
+
+// Castling rights left after a normal move in a Chess960 game
+func castlingAfterMove(p *position, from chess.Square, to chess.Square) string {
+	color := p.turn()
+	moved := p.squares[from]
+
+	keep := func(letter rune) bool {
+		letterColor := chess.White
+		file := chess.File(letter - 'A')
+		if letter >= 'a' {
+			letterColor = chess.Black
+			file = chess.File(letter - 'a')
+		}
+
+		rookSquare := chess.NewSquare(file, backRank(letterColor))
+		if letterColor == color && moved.Type() == chess.King {
+			return false
+		}
+
+		return from != rookSquare && to != rookSquare
+	}
+
+	castling := ""
+	for _, letter := range p.rights {
+		if keep(letter) {
+			castling += string(letter)
+		}
+	}
+
+	return castling
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+
+	return s
+}
+
+func parseSquare(s string) (chess.Square, bool) {
+	if len(s) != 2 || s[0] < 'a' || s[0] > 'h' || s[1] < '1' || s[1] > '8' {
+		return chess.NoSquare, false
+	}
+
+	return chess.NewSquare(chess.File(s[0]-'a'), chess.Rank(s[1]-'1')), true
+}
@@ -0,0 +1,94 @@
+package game
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestChess960FEN(t *testing.T) {
+	tests := []struct {
+		id      int
+		want    string
+		wantErr bool
+	}{
+		{standardChess960ID, "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w HAha - 0 1", false},
+		{0, "bbqnnrkr/pppppppp/8/8/8/8/PPPPPPPP/BBQNNRKR w HFhf - 0 1", false},
+		{959, "rkrnnqbb/pppppppp/8/8/8/8/PPPPPPPP/RKRNNQBB w CAca - 0 1", false},
+		{-1, "", true},
+		{960, "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := chess960FEN(tt.id)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("position %d: error %v, want error %v", tt.id, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("position %d: got %q, want %q", tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestChess960Castling(t *testing.T) {
+	tests := []struct {
+		name    string
+		fen     string
+		move    string
+		want    string
+		wantErr error
+	}{
+		{"king side", "r3k2r/8/8/8/8/8/8/R3K2R w HAha - 0 1", "O-O", "r3k2r/8/8/8/8/8/8/R4RK1 b ha - 1 1", nil},
+		{"queen side", "r3k2r/8/8/8/8/8/8/R3K2R w HAha - 0 1", "O-O-O", "r3k2r/8/8/8/8/8/8/2KR3R b ha - 1 1", nil},
+		{"black keeps white rights", "r3k2r/8/8/8/8/8/8/R3K2R b HAha - 0 1", "O-O", "r4rk1/8/8/8/8/8/8/R3K2R w HA - 1 2", nil},
+		{"king next to its rook", "k7/8/8/8/8/8/8/1R3KR1 w GB - 0 1", "O-O", "k7/8/8/8/8/8/8/1R3RK1 b - - 1 1", nil},
+		{"king takes rook in uci", "k7/8/8/8/8/8/8/1R3KR1 w GB - 0 1", "f1g1", "k7/8/8/8/8/8/8/1R3RK1 b - - 1 1", nil},
+		{"long way to the c file", "k7/8/8/8/8/8/8/1R3KR1 w GB - 0 1", "f1b1", "k7/8/8/8/8/8/8/2KR2R1 b - - 1 1", nil},
+		{"rook move drops its right", "r3k2r/8/8/8/8/8/8/R3K2R w HAha - 0 1", "a1a2", "r3k2r/8/8/8/8/8/R7/4K2R b Hha - 1 1", nil},
+		{"king move drops both rights", "r3k2r/8/8/8/8/8/8/R3K2R w HAha - 0 1", "e1e2", "r3k2r/8/8/8/8/8/4K3/R6R b ha - 1 1", nil},
+		{"blocked", "r3k2r/8/8/8/8/8/8/RN2K2R w HAha - 0 1", "O-O-O", "", errIllegalMove},
+		{"through an attacked square", "k4r2/8/8/8/8/8/8/R3K2R w HA - 0 1", "O-O", "", errIllegalMove},
+		{"out of check", "k3r3/8/8/8/8/8/8/R3K2R w HA - 0 1", "O-O-O", "", errIllegalMove},
+		{"right already lost", "r3k2r/8/8/8/8/8/8/R3K2R w Aha - 0 1", "O-O", "", errIllegalMove},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pos, err := newPosition(tt.fen, variantOf(&Game{Variant: VariantChess960}))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			played, err := pos.play(tt.move, "")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if played.after.fen != tt.want {
+				t.Errorf("got %q, want %q", played.after.fen, tt.want)
+			}
+		})
+	}
+}
+
+// Castling moves are listed with the other legal moves, once per side
+func TestChess960CastlingIsLegal(t *testing.T) {
+	pos, err := newPosition("k7/8/8/8/8/8/8/1R3KR1 w GB - 0 1", variantOf(&Game{Variant: VariantChess960}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var castles []string
+	for _, legal := range pos.legalPlies() {
+		if strings.HasPrefix(legal.san, "O-O") {
+			castles = append(castles, legal.san+" "+legal.uci)
+		}
+	}
+
+	if strings.Join(castles, ", ") != "O-O f1g1, O-O-O f1b1" && strings.Join(castles, ", ") != "O-O-O f1b1, O-O f1g1" {
+		t.Errorf("got %v, want O-O f1g1 and O-O-O f1b1", castles)
+	}
+}
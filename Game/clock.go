@@ -0,0 +1,284 @@
+package game
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	account "project/Account"
+
+	"github.com/gin-gonic/gin"
+)
+
+// A game without GameTime has no clocks
+func isTimed(game *Game) bool {
+	return game.GameTime > 0
+}
+
+// Correspondence games have a deadline per move instead of clocks
+func isCorrespondence(game *Game) bool {
+	return game.DaysPerMove > 0
+}
+
+// Side to move of the saved position, white moves on even plies
+// of games saved before positions were stored
+func whiteToMove(game *Game) bool {
+	if fields := strings.Fields(game.FEN); len(fields) > 1 {
+		return fields[1] == "w"
+	}
+
+	return len(game.Moves)%2 == 0
+}
+
+// Milliseconds spent by the player to move since the previous move was saved
+func elapsedSinceLastMove(game *Game, now time.Time) int64 {
+	since := game.LastMoveAt
+	if since.IsZero() {
+		since = game.StartTime
+	}
+
+	return now.Sub(since).Milliseconds()
+}
+
+// Both clocks as they are at `now`, the running one already deducted
+func currentClocks(game *Game, now time.Time) (int64, int64) {
+	white, black := game.WhiteClock, game.BlackClock
+
+	if !isTimed(game) || game.Status != StatusOngoing {
+		return white, black
+	}
+
+	spent := game.TimeControl.charge(elapsedSinceLastMove(game, now))
+	if whiteToMove(game) {
+		white -= spent
+	} else {
+		black -= spent
+	}
+
+	return max(white, 0), max(black, 0)
+}
+
+// Ends the game when the player to move has no time left
+// returns true if the game was lost on time
+func checkFlag(game *Game, now time.Time) bool {
+	if isCorrespondence(game) && game.Status == StatusOngoing {
+		if now.Before(game.MoveDeadline) {
+			return false
+		}
+
+		result := BlackWins
+		if !whiteToMove(game) {
+			result = WhiteWins
+		}
+
+		return finishGame(game, result, TerminationTimeout, now) == nil
+	}
+
+	if !isTimed(game) || game.Status != StatusOngoing {
+		return false
+	}
+
+	white, black := currentClocks(game, now)
+	if white > 0 && black > 0 {
+		return false
+	}
+
+	game.WhiteClock, game.BlackClock = white, black
+
+	result := WhiteWins
+	if white == 0 {
+		result = BlackWins
+	}
+
+	return finishGame(game, result, TerminationTimeout, now) == nil
+}
+
+// Saves and publishes the game when checkFlag ends it, a game another
+// request changed in the meantime is loaded again instead
+// returns true if the game was lost on time
+func saveFlag(game *Game, now time.Time) (bool, error) {
+	if !checkFlag(game, now) {
+		return false, nil
+	}
+
+	if err := updateGame(game); err == errGameChanged {
+		return false, db.First(game, "id = ?", game.ID).Error
+	} else if err != nil {
+		return false, err
+	}
+	publishGame(game, "end", "", now)
+
+	return true, nil
+}
+
+// A timer per running clock, so a game is lost on time even when
+// nobody loads it and every socket gets its "end"
+var flagTimers = struct {
+	sync.Mutex
+	byGame map[string]*time.Timer
+}{byGame: map[string]*time.Timer{}}
+
+// Sets the flag timer of a saved game to the time left of the player
+// to move, a game that is not running a clock has none
+func scheduleFlag(game *Game, now time.Time) {
+	flagTimers.Lock()
+	defer flagTimers.Unlock()
+
+	if timer, ok := flagTimers.byGame[game.ID]; ok {
+		timer.Stop()
+		delete(flagTimers.byGame, game.ID)
+	}
+	if !isTimed(game) || isCorrespondence(game) || game.Status != StatusOngoing {
+		return
+	}
+
+	white, black := currentClocks(game, now)
+	left := black
+	if whiteToMove(game) {
+		left = white
+	}
+
+	gameID := game.ID
+	flagTimers.byGame[gameID] = time.AfterFunc(time.Duration(left)*time.Millisecond, func() {
+		flagGame(gameID)
+	})
+}
+
+// Ends the game if its clock ran out, otherwise the timer is set again:
+// a simple delay or a move saved in the meantime leaves time on the clock
+func flagGame(gameID string) {
+	var game Game
+	if err := db.First(&game, "id = ?", gameID).Error; err != nil {
+		return
+	}
+
+	now := time.Now()
+	flagged, err := saveFlag(&game, now)
+	if err != nil {
+		log.Printf("failed to check the clock of game %s: %v", gameID, err)
+		return
+	}
+	if !flagged {
+		scheduleFlag(&game, now)
+	}
+}
+
+// Sets the flag timers of the games still running, for a restart
+func ScheduleFlags() {
+	var games []Game
+	if err := db.Where("status = ? AND game_time > 0 AND COALESCE(days_per_move, 0) = 0", StatusOngoing).Find(&games).Error; err != nil {
+		log.Printf("failed to load the running games: %v", err)
+		return
+	}
+
+	now := time.Now()
+	for i := range games {
+		if _, err := saveFlag(&games[i], now); err != nil {
+			log.Printf("failed to check the clock of game %s: %v", games[i].ID, err)
+			continue
+		}
+		scheduleFlag(&games[i], now)
+	}
+}
+
+// Deducts the time the mover used, adds the increment or delay
+// and restarts the clock for the opponent, the time left is kept in MoveClocks
+func pressClock(game *Game, now time.Time) {
+	if !isTimed(game) {
+		return
+	}
+
+	elapsed := elapsedSinceLastMove(game, now)
+	change := game.TimeControl.bonus(elapsed) - game.TimeControl.charge(elapsed)
+
+	if whiteToMove(game) {
+		game.WhiteClock += change
+		game.MoveClocks = append(game.MoveClocks, game.WhiteClock)
+	} else {
+		game.BlackClock += change
+		game.MoveClocks = append(game.MoveClocks, game.BlackClock)
+	}
+
+	game.LastMoveAt = now
+}
+
+// Deducts the time used so far without a bonus, used when the game
+// is changed between moves
+func stopClock(game *Game, now time.Time) {
+	if !isTimed(game) {
+		return
+	}
+
+	game.WhiteClock, game.BlackClock = currentClocks(game, now)
+	game.LastMoveAt = now
+}
+
+// Gives each player back the time they had after their last move left by a
+// takeback, the base time to a player with no move left, the clocks of
+// games saved before MoveClocks are kept as they are
+func restoreClocks(game *Game) {
+	if !isTimed(game) || len(game.MoveClocks) != len(game.Moves) {
+		return
+	}
+
+	game.WhiteClock, game.BlackClock = int64(game.GameTime)*1000, int64(game.GameTime)*1000
+
+	// Color of the first move, counted back from the side to move
+	white := (len(game.MoveClocks)%2 == 0) == whiteToMove(game)
+	for _, clock := range game.MoveClocks {
+		if white {
+			game.WhiteClock = clock
+		} else {
+			game.BlackClock = clock
+		}
+		white = !white
+	}
+}
+
+// Gives the player to move DaysPerMove days, counted from the end
+// of their vacation when they are away
+func startMoveDeadline(game *Game, now time.Time) {
+	if !isCorrespondence(game) {
+		return
+	}
+
+	start := now
+	var player account.Account
+	if err := db.Select("id", "vacation_until").First(&player, "id = ?", game.PlayerToMove()).Error; err == nil && player.VacationUntil.After(now) {
+		start = player.VacationUntil
+	}
+
+	game.LastMoveAt = now
+	game.MoveDeadline = start.Add(time.Duration(game.DaysPerMove) * 24 * time.Hour)
+	game.ReminderSent = false
+}
+
+func clocksResponse(game *Game, now time.Time) gin.H {
+	// The player to move has until the deadline, the other a whole period
+	if isCorrespondence(game) {
+		period := int64(game.DaysPerMove) * 24 * 3600 * 1000
+		left := period
+		if game.Status == StatusOngoing {
+			left = max(game.MoveDeadline.Sub(now).Milliseconds(), 0)
+		}
+
+		white, black := left, period
+		if !whiteToMove(game) {
+			white, black = period, left
+		}
+
+		return gin.H{
+			"white":    white,
+			"black":    black,
+			"deadline": game.MoveDeadline,
+		}
+	}
+
+	white, black := currentClocks(game, now)
+
+	return gin.H{
+		"white": white,
+		"black": black,
+	}
+}
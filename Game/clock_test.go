@@ -0,0 +1,162 @@
+package game
+
+import (
+	"testing"
+	"time"
+)
+
+const blackToMoveFEN = "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq - 0 1"
+
+func timedGame(tc TimeControl, clock int64, start time.Time) *Game {
+	return &Game{
+		Status:      StatusOngoing,
+		FEN:         startingFEN,
+		GameTime:    tc.BaseSeconds,
+		TimeControl: tc,
+		WhiteClock:  clock,
+		BlackClock:  clock,
+		StartTime:   start,
+	}
+}
+
+func TestPressClock(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		tc      TimeControl
+		elapsed time.Duration
+		want    int64
+	}{
+		{"no bonus", TimeControl{BaseSeconds: 60}, 5 * time.Second, 55000},
+		{"increment", TimeControl{BaseSeconds: 60, IncrementSeconds: 2}, 5 * time.Second, 57000},
+		{"simple delay used up", TimeControl{BaseSeconds: 60, DelaySeconds: 3, DelayType: SimpleDelay}, 5 * time.Second, 58000},
+		{"simple delay not used up", TimeControl{BaseSeconds: 60, DelaySeconds: 10, DelayType: SimpleDelay}, 5 * time.Second, 60000},
+		{"bronstein delay used up", TimeControl{BaseSeconds: 60, DelaySeconds: 3, DelayType: BronsteinDelay}, 5 * time.Second, 58000},
+		{"bronstein delay not used up", TimeControl{BaseSeconds: 60, DelaySeconds: 10, DelayType: BronsteinDelay}, 5 * time.Second, 60000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			game := timedGame(tt.tc, 60000, start)
+			now := start.Add(tt.elapsed)
+
+			pressClock(game, now)
+
+			if game.WhiteClock != tt.want {
+				t.Errorf("white clock %d, want %d", game.WhiteClock, tt.want)
+			}
+			if game.BlackClock != 60000 {
+				t.Errorf("black clock %d, want it untouched", game.BlackClock)
+			}
+			if len(game.MoveClocks) != 1 || game.MoveClocks[0] != tt.want {
+				t.Errorf("move clocks %v, want [%d]", game.MoveClocks, tt.want)
+			}
+			if !game.LastMoveAt.Equal(now) {
+				t.Errorf("last move at %v, want %v", game.LastMoveAt, now)
+			}
+		})
+	}
+}
+
+func TestCheckFlag(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		tc         TimeControl
+		fen        string
+		clock      int64
+		elapsed    time.Duration
+		flagged    bool
+		wantResult string
+	}{
+		{"time left", TimeControl{BaseSeconds: 60}, startingFEN, 1000, 999 * time.Millisecond, false, ""},
+		{"white out of time", TimeControl{BaseSeconds: 60}, startingFEN, 1000, time.Second, true, BlackWins},
+		{"black out of time", TimeControl{BaseSeconds: 60}, blackToMoveFEN, 1000, 2 * time.Second, true, WhiteWins},
+		{"simple delay not charged", TimeControl{BaseSeconds: 60, DelaySeconds: 3, DelayType: SimpleDelay}, startingFEN, 1000, 3500 * time.Millisecond, false, ""},
+		{"simple delay then out of time", TimeControl{BaseSeconds: 60, DelaySeconds: 3, DelayType: SimpleDelay}, startingFEN, 1000, 4 * time.Second, true, BlackWins},
+		{"untimed", TimeControl{}, startingFEN, 0, time.Hour, false, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			game := timedGame(tt.tc, tt.clock, start)
+			game.FEN = tt.fen
+
+			if got := checkFlag(game, start.Add(tt.elapsed)); got != tt.flagged {
+				t.Fatalf("checkFlag = %v, want %v", got, tt.flagged)
+			}
+			if !tt.flagged {
+				if game.Status != StatusOngoing {
+					t.Errorf("status %s, want it still ongoing", game.Status)
+				}
+				return
+			}
+
+			if game.Status != StatusFinished || game.Result != tt.wantResult || game.Termination != TerminationTimeout {
+				t.Errorf("got %s %s %s, want finished %s timeout", game.Status, game.Result, game.Termination, tt.wantResult)
+			}
+		})
+	}
+}
+
+func TestCurrentClocksOnlyRunForTheMover(t *testing.T) {
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	game := timedGame(TimeControl{BaseSeconds: 60}, 60000, start)
+	game.FEN = blackToMoveFEN
+	game.LastMoveAt = start
+
+	white, black := currentClocks(game, start.Add(90*time.Second))
+	if white != 60000 || black != 0 {
+		t.Errorf("clocks %d %d, want 60000 0", white, black)
+	}
+}
+
+func TestInitGivesLegacyGamesTheirClocks(t *testing.T) {
+	testDB(t)
+
+	legacy := []Game{
+		{ID: "legacy", Status: StatusOngoing, GameTime: 300, FEN: startingFEN},
+		{ID: "running", Status: StatusOngoing, GameTime: 300, FEN: startingFEN, WhiteClock: 1000, BlackClock: 2000},
+		{ID: "untimed", Status: StatusOngoing, FEN: startingFEN},
+		{ID: "finished", Status: StatusFinished, GameTime: 300, FEN: startingFEN},
+	}
+	for i := range legacy {
+		if err := db.Create(&legacy[i]).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	before := time.Now()
+	Init(db)
+
+	tests := []struct {
+		id          string
+		white       int64
+		black       int64
+		lastMoveSet bool
+	}{
+		{"legacy", 300000, 300000, true},
+		{"running", 1000, 2000, false},
+		{"untimed", 0, 0, false},
+		{"finished", 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		var game Game
+		if err := db.First(&game, "id = ?", tt.id).Error; err != nil {
+			t.Fatal(err)
+		}
+
+		if game.WhiteClock != tt.white || game.BlackClock != tt.black {
+			t.Errorf("%s: clocks %d %d, want %d %d", tt.id, game.WhiteClock, game.BlackClock, tt.white, tt.black)
+		}
+		if set := !game.LastMoveAt.Before(before.Truncate(time.Second)); set != tt.lastMoveSet {
+			t.Errorf("%s: last move at %v, want it set to now %v", tt.id, game.LastMoveAt, tt.lastMoveSet)
+		}
+		if tt.id == "legacy" && checkFlag(&game, time.Now()) {
+			t.Errorf("%s: lost on time right after the migration", tt.id)
+		}
+	}
+}
@@ -0,0 +1,278 @@
+package game
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	account "project/Account"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const (
+	minDaysPerMove = 1
+	maxDaysPerMove = 14
+
+	// Vacation days each player can take in a calendar year
+	vacationDaysPerYear = 30
+
+	correspondenceCheckEvery = time.Minute
+)
+
+// How long before the deadline the player to move is reminded,
+// a quarter of the period for short ones and a day at most
+func reminderLead(game *Game) time.Duration {
+	return min(time.Duration(game.DaysPerMove)*24*time.Hour/4, 24*time.Hour)
+}
+
+// Ends the correspondence games whose deadline passed and reminds
+// the players whose deadline is close
+func checkCorrespondence(now time.Time) {
+	var games []Game
+	if err := db.Where("status = ? AND days_per_move > 0", StatusOngoing).Find(&games).Error; err != nil {
+		log.Printf("failed to load correspondence games: %v", err)
+		return
+	}
+
+	for i := range games {
+		game := &games[i]
+
+		if checkFlag(game, now) {
+			// A game moved or given more time by a vacation in the
+			// meantime is checked again next time
+			if err := updateGameWith(game, deadlineUnchanged(game)); err != nil {
+				log.Printf("failed to end correspondence game %s: %v", game.ID, err)
+				continue
+			}
+			publishGame(game, "end", "", now)
+			continue
+		}
+
+		if !game.ReminderSent && game.MoveDeadline.Sub(now) <= reminderLead(game) {
+			if err := sendMoveReminder(game, now); err != nil {
+				// Tried again on the next check
+				log.Printf("failed to remind the player of game %s: %v", game.ID, err)
+				continue
+			}
+			game.ReminderSent = true
+			if err := updateGameWith(game, deadlineUnchanged(game), "reminder_sent"); err != nil {
+				// The player may be reminded again on the next check
+				log.Printf("failed to save the reminder of game %s: %v", game.ID, err)
+			}
+		}
+	}
+}
+
+// Fails the update of a game whose deadline was moved since it was loaded,
+// the deadline is compared in Go as its stored text depends on the time zone
+func deadlineUnchanged(game *Game) func(tx *gorm.DB) error {
+	loaded := game.MoveDeadline
+
+	return func(tx *gorm.DB) error {
+		var current Game
+		if err := tx.Select("move_deadline").First(&current, "id = ?", game.ID).Error; err != nil {
+			return err
+		}
+		if !current.MoveDeadline.Equal(loaded) {
+			return errGameChanged
+		}
+		return nil
+	}
+}
+
+// Sends the reminders, replaced by the tests
+var sendEmail = account.SendEmail
+
+func sendMoveReminder(game *Game, now time.Time) error {
+	var player account.Account
+	if err := db.First(&player, "id = ?", game.PlayerToMove()).Error; err != nil {
+		return err
+	}
+
+	usernames := map[string]string{}
+	loadUsernames(usernames, game)
+	opponentID := game.WhitePlayerID
+	if opponentID == player.ID {
+		opponentID = game.BlackPlayerID
+	}
+
+	left := game.MoveDeadline.Sub(now).Round(time.Minute)
+	message := fmt.Sprintf("It is your move in your correspondence game against %s (game %s).\nYou have %s left, the game is lost on time on %s.",
+		playerName(usernames, opponentID, ""), game.ID, left, game.MoveDeadline.Format("Mon 2 Jan 2006 15:04 MST"))
+
+	return sendEmail(player.Email, "Your move is due soon", message)
+}
+
+// Checks the correspondence games in the background, never returns
+func RunCorrespondenceWorker() {
+	ticker := time.NewTicker(correspondenceCheckEvery)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		checkCorrespondence(now)
+	}
+}
+
+// Vacation days the player can still take this year
+func vacationDaysLeft(player *account.Account, now time.Time) int {
+	if player.VacationYear != now.Year() {
+		return vacationDaysPerYear
+	}
+
+	return vacationDaysPerYear - player.VacationDaysUsed
+}
+
+// Moves the deadline of every correspondence game where the player is to move
+func shiftDeadlines(playerID string, by time.Duration, now time.Time) error {
+	var games []Game
+	if err := db.Where("status = ? AND days_per_move > 0 AND (white_player_id = ? OR black_player_id = ?)", StatusOngoing, playerID, playerID).Find(&games).Error; err != nil {
+		return err
+	}
+
+	for i := range games {
+		game := &games[i]
+		if game.PlayerToMove() != playerID {
+			continue
+		}
+
+		unchanged := deadlineUnchanged(game)
+		game.MoveDeadline = game.MoveDeadline.Add(by)
+		// A deadline pushed back far enough gets a new reminder
+		if game.MoveDeadline.Sub(now) > reminderLead(game) {
+			game.ReminderSent = false
+		}
+
+		// A game that moved in the meantime has a deadline set by that
+		// move, which already starts from the end of the vacation
+		if err := updateGameWith(game, unchanged, "move_deadline", "reminder_sent"); err == errGameChanged {
+			continue
+		} else if err != nil {
+			return err
+		}
+		publishGame(game, "update", "Deadline moved by a vacation", now)
+	}
+
+	return nil
+}
+
+func loadVacationAccount(c *gin.Context) (*account.Account, bool) {
+	accountID, ID_exists := c.Get("accountID")
+	if !ID_exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return nil, false
+	}
+
+	var player account.Account
+	if err := db.First(&player, "id = ?", accountID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+		return nil, false
+	}
+
+	return &player, true
+}
+
+// GET
+// Your vacation days left this year and the end of your current vacation
+func GetVacation(c *gin.Context) {
+	player, ok := loadVacationAccount(c)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	response := gin.H{"days_left": vacationDaysLeft(player, now), "on_vacation": player.VacationUntil.After(now)}
+	if player.VacationUntil.After(now) {
+		response["vacation_until"] = player.VacationUntil
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// POST
+// Go on vacation: your correspondence deadlines are pushed back by its length
+// req = days
+func StartVacation(c *gin.Context) {
+	player, ok := loadVacationAccount(c)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Days int `json:"days" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	if player.VacationUntil.After(now) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You are already on vacation"})
+		return
+	}
+
+	left := vacationDaysLeft(player, now)
+	if input.Days < 1 || input.Days > left {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("days must be between 1 and %d", left)})
+		return
+	}
+
+	used := vacationDaysPerYear - left + input.Days
+	until := now.Add(time.Duration(input.Days) * 24 * time.Hour)
+	if err := db.Model(&account.Account{}).Where("id = ?", player.ID).Updates(map[string]interface{}{
+		"vacation_year":      now.Year(),
+		"vacation_days_used": used,
+		"vacation_until":     until,
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := shiftDeadlines(player.ID, until.Sub(now), now); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"vacation_until": until, "days_left": vacationDaysPerYear - used})
+}
+
+// DELETE
+// Come back early, the whole days not used are given back
+func EndVacation(c *gin.Context) {
+	player, ok := loadVacationAccount(c)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	if !player.VacationUntil.After(now) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You are not on vacation"})
+		return
+	}
+
+	remaining := player.VacationUntil.Sub(now)
+	used := max(player.VacationDaysUsed-int(remaining/(24*time.Hour)), 0)
+	if player.VacationYear != now.Year() {
+		// The vacation started last year, this year's days are untouched
+		used = 0
+	}
+
+	if err := db.Model(&account.Account{}).Where("id = ?", player.ID).Updates(map[string]interface{}{
+		"vacation_year":      now.Year(),
+		"vacation_days_used": used,
+		"vacation_until":     now,
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := shiftDeadlines(player.ID, -remaining, now); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Welcome back", "days_left": vacationDaysPerYear - used})
+}
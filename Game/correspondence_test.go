@@ -0,0 +1,166 @@
+package game
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// Correspondence game of 3 days per move between alice (white) and bob
+func correspondenceGame(t *testing.T, id string, fen string, deadline time.Time, reminded bool) {
+	t.Helper()
+
+	game := Game{ID: id, WhitePlayerID: "alice", BlackPlayerID: "bob", Status: StatusOngoing, DaysPerMove: 3, FEN: fen, StartFEN: startingFEN, MoveDeadline: deadline, ReminderSent: reminded}
+	if err := db.Create(&game).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Replaces the email sender for the test, returns the addresses reminded
+func captureEmails(t *testing.T, fail bool) *[]string {
+	t.Helper()
+
+	var sent []string
+	previous := sendEmail
+	sendEmail = func(to string, subject string, message string) error {
+		if fail {
+			return errors.New("smtp is down")
+		}
+		sent = append(sent, to)
+		return nil
+	}
+	t.Cleanup(func() { sendEmail = previous })
+
+	return &sent
+}
+
+func TestCheckCorrespondence(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name         string
+		fen          string
+		deadline     time.Time
+		reminded     bool
+		emailFails   bool
+		wantStatus   Status
+		wantResult   string
+		wantEmails   []string
+		wantReminded bool
+	}{
+		{"deadline far away", startingFEN, now.Add(48 * time.Hour), false, false, StatusOngoing, "", nil, false},
+		{"white close to the deadline", startingFEN, now.Add(time.Hour), false, false, StatusOngoing, "", []string{"alice@example.com"}, true},
+		{"black close to the deadline", blackToMoveFEN, now.Add(time.Hour), false, false, StatusOngoing, "", []string{"bob@example.com"}, true},
+		{"already reminded", startingFEN, now.Add(time.Hour), true, false, StatusOngoing, "", nil, true},
+		{"reminder not sent", startingFEN, now.Add(time.Hour), false, true, StatusOngoing, "", nil, false},
+		{"white out of time", startingFEN, now.Add(-time.Minute), false, false, StatusFinished, BlackWins, nil, false},
+		{"black out of time", blackToMoveFEN, now.Add(-time.Minute), true, false, StatusFinished, WhiteWins, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testDB(t)
+			createAccounts(t, "alice", "bob")
+			sent := captureEmails(t, tt.emailFails)
+			correspondenceGame(t, "game", tt.fen, tt.deadline, tt.reminded)
+
+			checkCorrespondence(now)
+
+			var saved Game
+			if err := db.First(&saved, "id = ?", "game").Error; err != nil {
+				t.Fatal(err)
+			}
+			if saved.Status != tt.wantStatus || saved.Result != tt.wantResult {
+				t.Errorf("got %s %q, want %s %q", saved.Status, saved.Result, tt.wantStatus, tt.wantResult)
+			}
+			if tt.wantStatus == StatusFinished && saved.Termination != TerminationTimeout {
+				t.Errorf("termination %q, want timeout", saved.Termination)
+			}
+			if len(*sent) != len(tt.wantEmails) || (len(tt.wantEmails) > 0 && (*sent)[0] != tt.wantEmails[0]) {
+				t.Errorf("emails to %v, want %v", *sent, tt.wantEmails)
+			}
+			if saved.ReminderSent != tt.wantReminded {
+				t.Errorf("reminder sent %v, want %v", saved.ReminderSent, tt.wantReminded)
+			}
+		})
+	}
+}
+
+func TestVacationShiftsDeadlines(t *testing.T) {
+	testDB(t)
+	createAccounts(t, "alice", "bob")
+
+	deadline := time.Now().Add(2 * time.Hour).Truncate(time.Second)
+	correspondenceGame(t, "alice to move", startingFEN, deadline, true)
+	correspondenceGame(t, "bob to move", blackToMoveFEN, deadline, true)
+	correspondenceGame(t, "finished", startingFEN, deadline, true)
+	db.Model(&Game{}).Where("id = ?", "finished").Update("status", StatusFinished)
+
+	deadlineOf := func(id string) (time.Time, bool) {
+		var game Game
+		if err := db.First(&game, "id = ?", id).Error; err != nil {
+			t.Fatal(err)
+		}
+		return game.MoveDeadline, game.ReminderSent
+	}
+
+	if w := apiRequest(http.MethodPost, "/vacation", "alice", `{"days": 3}`); w.Code != http.StatusOK {
+		t.Fatalf("start vacation: got %d %s", w.Code, w.Body.String())
+	}
+
+	tests := []struct {
+		id           string
+		want         time.Time
+		wantReminded bool
+	}{
+		{"alice to move", deadline.Add(72 * time.Hour), false},
+		{"bob to move", deadline, true},
+		{"finished", deadline, true},
+	}
+	for _, tt := range tests {
+		got, reminded := deadlineOf(tt.id)
+		if got.Sub(tt.want).Abs() > time.Second || reminded != tt.wantReminded {
+			t.Errorf("on vacation, %s: deadline %v reminded %v, want %v reminded %v", tt.id, got, reminded, tt.want, tt.wantReminded)
+		}
+	}
+
+	// Coming back at once gives the whole vacation back
+	if w := apiRequest(http.MethodDelete, "/vacation", "alice", ""); w.Code != http.StatusOK {
+		t.Fatalf("end vacation: got %d %s", w.Code, w.Body.String())
+	}
+	if got, _ := deadlineOf("alice to move"); got.Sub(deadline).Abs() > time.Second {
+		t.Errorf("back from vacation: deadline %v, want %v", got, deadline)
+	}
+}
+
+// A deadline set by a move after the game was loaded is kept
+func TestDeadlineUnchangedGuard(t *testing.T) {
+	testDB(t)
+	createAccounts(t, "alice", "bob")
+
+	deadline := time.Now().Add(time.Hour).Truncate(time.Second)
+	correspondenceGame(t, "game", startingFEN, deadline, false)
+
+	var stale Game
+	if err := db.First(&stale, "id = ?", "game").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	moved := deadline.Add(48 * time.Hour)
+	db.Model(&Game{}).Where("id = ?", "game").Update("move_deadline", moved)
+
+	unchanged := deadlineUnchanged(&stale)
+	stale.MoveDeadline = stale.MoveDeadline.Add(72 * time.Hour)
+	if err := updateGameWith(&stale, unchanged, "move_deadline"); err != errGameChanged {
+		t.Fatalf("error %v, want errGameChanged", err)
+	}
+
+	var saved Game
+	if err := db.First(&saved, "id = ?", "game").Error; err != nil {
+		t.Fatal(err)
+	}
+	if !saved.MoveDeadline.Equal(moved) {
+		t.Errorf("deadline %v, want the one set meanwhile %v", saved.MoveDeadline, moved)
+	}
+}
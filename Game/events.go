@@ -0,0 +1,38 @@
+package game
+
+import (
+	events "project/Events"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Tells both players a game of theirs has started
+func announceGame(game *Game) {
+	players := map[string]string{game.WhitePlayerID: game.BlackPlayerID, game.BlackPlayerID: game.WhitePlayerID}
+	for playerID, opponentID := range players {
+		events.Publish(playerID, events.TypeGameStarted, gin.H{
+			"game_id":      game.ID,
+			"color":        game.ColorOf(playerID),
+			"opponent_id":  opponentID,
+			"variant":      game.Variant,
+			"time_control": game.TimeControl.String(),
+			"rated":        game.Rated,
+		})
+	}
+}
+
+// Tells the opponent of the mover about the move
+func announceMove(game *Game, moverID string, san string) {
+	opponentID := game.WhitePlayerID
+	if moverID == game.WhitePlayerID {
+		opponentID = game.BlackPlayerID
+	}
+
+	events.Publish(opponentID, events.TypeOpponentMove, gin.H{
+		"game_id": game.ID,
+		"move":    san,
+		"fen":     game.FEN,
+		"status":  game.Status,
+		"result":  game.Result,
+	})
+}
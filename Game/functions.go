@@ -1,12 +1,19 @@
 package game
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
-	"github.com/notnil/chess"
 	"gorm.io/gorm"
 )
 
@@ -14,16 +21,39 @@ var db *gorm.DB
 
 func Init(database *gorm.DB) {
 	db = database
+
+	// Games created before colors were stored had player1 as white
+	if db.Migrator().HasColumn(&Game{}, "player1_id") {
+		db.Exec("UPDATE games SET white_player_id = player1_id, black_player_id = player2_id WHERE white_player_id IS NULL OR white_player_id = ''")
+	}
+
+	// Ended games used to be "completed"
+	db.Model(&Game{}).Where("status = ?", "completed").Update("status", StatusFinished)
+
+	// Game types were picked by the client, "classic" is now the classical category
+	db.Model(&Game{}).Where("game_type = ?", "classic").Update("game_type", Classical)
+
+	// Games started before clocks were stored would lose on time at once,
+	// they get their full base time back from now
+	db.Model(&Game{}).Where("status = ? AND game_time > 0 AND COALESCE(white_clock, 0) = 0 AND COALESCE(black_clock, 0) = 0", StatusOngoing).
+		Updates(map[string]interface{}{"white_clock": gorm.Expr("game_time * 1000"), "black_clock": gorm.Expr("game_time * 1000"), "last_move_at": time.Now()})
 }
 
 // POST
-// Create a game 
+// Create a game, without player2_id it waits for an opponent to join
 func CreateGame(c *gin.Context) {
     var input struct {
         Player1ID string `json:"player1_id"`
         Player2ID string `json:"player2_id"`
-        GameType  string `json:"game_type"`
+        Color     string `json:"color"` // color of player1: white, black or random
+        TimeControl string `json:"time_control"`
         GameTime  int `json:"game_time"`
+        Rated     *bool `json:"rated"`
+        Variant   string `json:"variant"` // standard, chess960, from_position, king_of_the_hill, three_check or horde
+        Chess960ID *int `json:"chess960_id"` // random when empty
+        FEN       string `json:"fen"` // start of a from_position game
+        Private   bool `json:"private"`
+        DaysPerMove int `json:"days_per_move"` // 1 to 14 for a correspondence game, time_control is not used then
     }
 
     if err := c.ShouldBindJSON(&input); err != nil {
@@ -31,137 +61,437 @@ func CreateGame(c *gin.Context) {
         return
     }
 
-     
-    if input.Player1ID == input.Player2ID { 
-        c.JSON(http.StatusBadRequest, gin.H{"error": "Player1 and Player2 cannot be the same"})
+    var timeControl TimeControl
+    if input.DaysPerMove == 0 {
+        var err error
+        if input.TimeControl == "" && input.GameTime > 0 {
+            // Old clients only send the base time in seconds
+            timeControl = TimeControl{BaseSeconds: input.GameTime}
+            err = timeControl.Validate()
+        } else {
+            timeControl, err = ParseTimeControl(input.TimeControl)
+        }
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return
+        }
+    }
+
+    if input.Player1ID == "" {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "player1_id is required"})
         return
     }
 
-    var ongoingGame Game
-    if err := db.Where("status = ? AND (player1_id = ? OR player2_id = ?)", "ongoing", input.Player1ID, input.Player2ID).First(&ongoingGame).Error; err == nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "One of the players is already in an ongoing game"})
+    whiteID, blackID, err := assignColors(input.Player1ID, input.Player2ID, input.Color)
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
         return
     }
 
-    if input.GameType != "blitz" && input.GameType != "bullet" && input.GameType != "classic" { 
-        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid Game Type"})
+    // Games are rated unless asked otherwise
+    rated := input.Rated == nil || *input.Rated
+
+    newGame, err := buildGame(whiteID, blackID, gameOptions{
+        TimeControl: timeControl,
+        Rated:       rated,
+        Variant:     input.Variant,
+        Chess960ID:  input.Chess960ID,
+        FEN:         input.FEN,
+        Private:     input.Private,
+        DaysPerMove: input.DaysPerMove,
+    })
+    if err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
         return
     }
 
-    newGame := Game{
-		ID: uuid.New().String(),
-        Player1ID: input.Player1ID,
-        Player2ID: input.Player2ID,
-        StartTime: time.Now(),
-        GameType:  input.GameType,
-        GameTime:  input.GameTime,
-        Status:    "ongoing",
+    // Without player2 the game waits for someone to join it
+    if input.Player2ID == "" {
+        if err := newGame.transition(StatusWaiting); err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+        if err := db.Create(newGame).Error; err != nil {
+            c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+            return
+        }
+
+        c.JSON(http.StatusOK, gin.H{"game": newGame})
+        return
     }
 
-    if err := db.Create(&newGame).Error; err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+    if status, err := startGame(newGame); err != nil {
+        c.JSON(status, gin.H{"error": err.Error()})
         return
     }
 	
     c.JSON(http.StatusOK, gin.H{"game": newGame})
 }
 
-// PUT
-// Func to Add Move to the game 
+// What a new game is played with besides its players
+type gameOptions struct {
+	TimeControl TimeControl
+	Rated       bool
+	Variant     string // standard when empty
+	Chess960ID  *int   // random when nil
+	FEN         string // start of a from_position game
+	Private     bool
+	DaysPerMove int // a correspondence game when set, TimeControl is ignored
+}
+
+// White and black from the color player1 asked for: white, black or random
+func assignColors(player1ID string, player2ID string, color string) (string, string, error) {
+	switch color {
+	case "white":
+		return player1ID, player2ID, nil
+	case "black":
+		return player2ID, player1ID, nil
+	case "", "random":
+		if rand.Intn(2) == 1 {
+			return player2ID, player1ID, nil
+		}
+		return player1ID, player2ID, nil
+	}
+
+	return "", "", errors.New("Color must be white, black or random")
+}
+
+// Rating category of a game with these options
+func gameTypeOf(variant string, timeControl TimeControl, daysPerMove int) string {
+	if rules, ok := variants[variant]; ok && rules.ratingPool() != "" {
+		return rules.ratingPool()
+	}
+	if daysPerMove > 0 {
+		return Correspondence
+	}
+
+	return timeControl.Category()
+}
+
+// Game between two players with the rules of CreateGame, not saved yet
+// every error comes from the options
+func buildGame(whiteID string, blackID string, opts gameOptions) (*Game, error) {
+	if whiteID == blackID {
+		return nil, errors.New("Player1 and Player2 cannot be the same")
+	}
+
+	if opts.DaysPerMove != 0 {
+		if opts.DaysPerMove < minDaysPerMove || opts.DaysPerMove > maxDaysPerMove {
+			return nil, fmt.Errorf("days_per_move must be between %d and %d", minDaysPerMove, maxDaysPerMove)
+		}
+		opts.TimeControl = TimeControl{}
+	}
+
+	rated := opts.Rated
+	variant, chess960ID, fen := VariantStandard, 0, startingFEN
+	switch opts.Variant {
+	case "", VariantStandard:
+	case VariantKingOfTheHill, VariantThreeCheck, VariantHorde:
+		rules := variants[opts.Variant]
+		variant, fen = rules.name(), rules.startFEN()
+	case VariantChess960:
+		variant, chess960ID = VariantChess960, randomChess960ID()
+		if opts.Chess960ID != nil {
+			chess960ID = *opts.Chess960ID
+		}
+
+		var err error
+		if fen, err = chess960FEN(chess960ID); err != nil {
+			return nil, err
+		}
+	case VariantFromPosition:
+		if _, err := validateStartFEN(opts.FEN); err != nil {
+			return nil, err
+		}
+
+		// Training positions are never rated
+		variant, fen, rated = VariantFromPosition, opts.FEN, false
+	default:
+		return nil, errors.New("Variant must be standard, chess960, from_position, king_of_the_hill, three_check or horde")
+	}
+
+	return &Game{
+		ID:             uuid.New().String(),
+		WhitePlayerID:  whiteID,
+		BlackPlayerID:  blackID,
+		StartTime:      time.Now(),
+		GameType:       gameTypeOf(variant, opts.TimeControl, opts.DaysPerMove),
+		GameTime:       opts.TimeControl.BaseSeconds,
+		TimeControl:    opts.TimeControl,
+		Rated:          rated,
+		Status:         StatusCreated,
+		WhiteClock:     int64(opts.TimeControl.BaseSeconds) * 1000,
+		BlackClock:     int64(opts.TimeControl.BaseSeconds) * 1000,
+		Variant:        variant,
+		Chess960ID:     chess960ID,
+		StartFEN:       fen,
+		FEN:            fen,
+		PositionHashes: StringArray{positionHash(fen)},
+		Private:        opts.Private,
+		DaysPerMove:    opts.DaysPerMove,
+	}, nil
+}
+
+// True when one of the accounts plays a game that is going on
+func inOngoingGame(accountIDs ...string) bool {
+	var ongoingGame Game
+	return db.Where("status = ? AND (white_player_id IN ? OR black_player_id IN ?)", StatusOngoing, accountIDs, accountIDs).First(&ongoingGame).Error == nil
+}
+
+// Starts and saves a built game, unless one of its players is already playing
+// returns the HTTP status of a failure with its error
+func startGame(game *Game) (int, error) {
+	if inOngoingGame(game.WhitePlayerID, game.BlackPlayerID) {
+		return http.StatusBadRequest, errors.New("One of the players is already in an ongoing game")
+	}
+
+	if err := game.transition(StatusOngoing); err != nil {
+		return http.StatusInternalServerError, err
+	}
+	startMoveDeadline(game, time.Now())
+
+	if err := db.Create(game).Error; err != nil {
+		return http.StatusInternalServerError, err
+	}
+	scheduleFlag(game, time.Now())
+	announceGame(game)
+
+	return http.StatusOK, nil
+}
+
+// POST
+// Join a game waiting for its opponent, it starts right away
 // req = id(from the url)
+func JoinGame(c *gin.Context) {
+	accountID, ID_exists := c.Get("accountID")
+	if !ID_exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var game Game
+	if err := db.First(&game, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Game not found"})
+		return
+	}
+
+	if game.Status != StatusWaiting {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Game is not waiting for an opponent"})
+		return
+	}
+	if game.ColorOf(accountID.(string)) != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You can't join your own game"})
+		return
+	}
+	if inOngoingGame(accountID.(string)) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You are already in an ongoing game"})
+		return
+	}
+
+	if game.WhitePlayerID == "" {
+		game.WhitePlayerID = accountID.(string)
+	} else {
+		game.BlackPlayerID = accountID.(string)
+	}
+
+	if err := game.transition(StatusOngoing); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The clocks start from the join, not from when the game was created
+	now := time.Now()
+	game.StartTime = now
+	startMoveDeadline(&game, now)
+
+	if err := updateGame(&game, "white_player_id", "black_player_id", "status", "start_time", "last_move_at", "move_deadline"); err != nil {
+		c.JSON(updateStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	announceGame(&game)
+
+	c.JSON(http.StatusOK, gin.H{"game": game})
+}
+
+// PUT
+// This func is for ADMINS ONLY
+// Adjudicate an ongoing game with the given result
+// req = id(from the url), result (1-0, 0-1 or 1/2-1/2)
 func EndGame(c *gin.Context) {
 	gameID := c.Param("id")
 
+	isAdmin, Admin_exists := c.Get("isAdmin")
+
+	if !Admin_exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	if !isAdmin.(bool) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "This url is for ADMIN ONLY."})
+		return
+	}
+
+    var input struct {
+        Result string `json:"result" binding:"required"`
+    }
+    if err := c.ShouldBindJSON(&input); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
+
+    if input.Result != WhiteWins && input.Result != BlackWins && input.Result != Drawn {
+        c.JSON(http.StatusBadRequest, gin.H{"error": "Result must be 1-0, 0-1 or 1/2-1/2"})
+        return
+    }
+
     var game Game
     if err := db.First(&game, "id = ?", gameID).Error; err != nil {
         c.JSON(http.StatusNotFound, gin.H{"error": "Game not found"})
         return
     }
 
-    if game.Status == "ongoing" {
-        endTime := time.Now()
-        game.Status = "completed" // Or determine if it was a draw, win, etc.
-        game.EndTime = endTime
-
-		if err := db.Save(&game).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
+    now := time.Now()
+    stopClock(&game, now)
+    if err := finishGame(&game, input.Result, TerminationAdjudication, now); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
 
-		c.JSON(http.StatusOK, gin.H{"message": "Game ended"})
-    } else {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "Game already ended"})
+    if err := updateGame(&game); err != nil {
+        c.JSON(updateStatus(err), gin.H{"error": err.Error()})
+        return
     }
+    publishGame(&game, "end", "Game ended", now)
+
+    c.JSON(http.StatusOK, gin.H{"message": "Game ended", "game": game})
 }
 
 // POST
 // Func to Add Move to the game 
+// only the player whose color is to move can play
 func MakeMove(c *gin.Context) {
-	gameID := c.Param("id")
+    accountID, ID_exists := c.Get("accountID")
+    if !ID_exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+    var input struct {
+        Move     string `json:"move"`
+        Notation string `json:"notation"` // san, uci or lan, detected when empty
+    }
+    if err := c.ShouldBindJSON(&input); err != nil {
+        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+        return
+    }
 
+    now := time.Now()
+    game, status, err := submitMove(c.Param("id"), accountID.(string), input.Move, input.Notation, now)
+    if err == errTimeUp {
+        c.JSON(status, gin.H{"error": err.Error(), "game": game, "clocks": clocksResponse(game, now)})
+        return
+    }
+    if err != nil {
+        c.JSON(status, gin.H{"error": err.Error()})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{"game": game, "clocks": clocksResponse(game, now)})
+}
+
+var errTimeUp = errors.New("Time is up")
+
+// Plays a move of a player and saves the game, shared by MakeMove and the game socket
+// returns the HTTP status of a failure with its error
+func submitMove(gameID string, accountID string, moveStr string, notation string, now time.Time) (*Game, int, error) {
     var game Game
     if err := db.First(&game, "id = ?", gameID).Error; err != nil {
-        c.JSON(http.StatusNotFound, gin.H{"error": "Game not found"})
-        return
+        return nil, http.StatusNotFound, errors.New("Game not found")
     }
 
-    if game.Status != "ongoing" {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "Game already ended"})
+    if flagged, err := saveFlag(&game, now); err != nil {
+        return nil, http.StatusInternalServerError, err
+    } else if flagged {
+        return &game, http.StatusBadRequest, errTimeUp
     }
 
-    var input struct {
-        Move string `json:"move"`
+    if err := game.require(StatusOngoing); err != nil {
+        return nil, http.StatusBadRequest, err
     }
-    if err := c.ShouldBindJSON(&input); err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-        return
+
+    if game.ColorOf(accountID) == "" {
+        return nil, http.StatusForbidden, errors.New("You are not a player in this game")
     }
 
-    // Initialize a new chess game
-    chessGame := chess.NewGame()
+    if game.PlayerToMove() != accountID {
+        return nil, http.StatusForbidden, errors.New("It is not your turn")
+    }
 
-    // Replay all previous moves from the game
-    for _, moveStr := range game.Moves {
-        move, err := chess.AlgebraicNotation{}.Decode(chessGame.Position(), moveStr)
-        if err != nil {
-            c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid previous move: " + moveStr})
-            return
-        }
-        chessGame.Move(move)
+    // Continue from the saved position
+    pos, err := loadPosition(&game)
+    if err != nil {
+        return nil, http.StatusBadRequest, err
     }
 
     // Apply the new move
-    newMove, err := chess.AlgebraicNotation{}.Decode(chessGame.Position(), input.Move)
+    played, err := pos.play(moveStr, notation)
     if err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid move format"})
-        return
+        return nil, http.StatusBadRequest, err
     }
 
-    if err := chessGame.Move(newMove); err != nil {
-        c.JSON(http.StatusBadRequest, gin.H{"error": "Illegal move"})
-        return
+    pressClock(&game, now)
+    game.DrawOfferBy, game.TakebackBy = "", ""
+    game.Moves = append(game.Moves, played.san)
+    recordPosition(&game, played.after)
+    startMoveDeadline(&game, now)
+
+    if result, termination := detectOutcome(&game, played.after); result != "" {
+        if err := finishGame(&game, result, termination, now); err != nil {
+            return nil, http.StatusInternalServerError, err
+        }
     }
 
-    game.Moves = append(game.Moves, input.Move)
-	
-    if err := db.Save(&game).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
+    // Pockets are changed in SQL, never written from the loaded game
+    var pockets func(tx *gorm.DB) error
+    if game.BughouseID != "" {
+        pockets = func(tx *gorm.DB) error { return updatePockets(tx, &game, played) }
+    }
+    if err := updateGameWith(&game, pockets, moveColumns...); err != nil {
+        return nil, updateStatus(err), err
+    }
 
-    c.JSON(http.StatusOK, gin.H{"game": game})
+    publishGame(&game, "move", played.san, now)
+    announceMove(&game, accountID, played.san)
+    return &game, http.StatusOK, nil
 }
 
 // GET
 // Get all moves of one game 
+// req = id(from the url), notation (san, uci or lan, from the query)
 func GetMoves(c *gin.Context) {
     var game Game
-    if err := db.First(&game, "id = ?", c.Param("id")).Error; err != nil {
-        c.JSON(http.StatusNotFound, gin.H{"error": "Game not found"})
+    if !loadVisibleGame(c, &game) {
         return
     }
 
-    c.JSON(http.StatusOK, gin.H{"moves": game.Moves})
+    now := time.Now()
+    if _, err := saveFlag(&game, now); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+
+    moves := []string(game.Moves)
+    if notation := c.DefaultQuery("notation", "san"); notation != "san" {
+        converted, err := encodeMoves(&game, notation)
+        if err != nil {
+            c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+            return
+        }
+        moves = converted
+    }
+
+    c.JSON(http.StatusOK, gin.H{"moves": moves, "clocks": clocksResponse(&game, now)})
 }
 
 // GET
@@ -175,7 +505,7 @@ func GetActiveGame(c *gin.Context) {
 	}
 
     var games []Game
-    if err := db.Where("status = ? AND (player1_id = ? OR player2_id = ?)", "ongoing", accountID, accountID).Find(&games).Error; err != nil {
+    if err := db.Where("status = ? AND (white_player_id = ? OR black_player_id = ?)", StatusOngoing, accountID, accountID).Find(&games).Error; err != nil {
         c.JSON(http.StatusNotFound, gin.H{"error": "No active games found for this player"})
         return
     }
@@ -201,7 +531,7 @@ func GetMyGames(c *gin.Context) {
 	
     var games []Game
 
-    if err := db.Where("player1_id = ? OR player2_id = ?", accountID, accountID).Find(&games).Error; err != nil {
+    if err := db.Where("white_player_id = ? OR black_player_id = ?", accountID, accountID).Find(&games).Error; err != nil {
         c.JSON(http.StatusNotFound, gin.H{"error": "No games found"})
         return
     }
@@ -210,9 +540,12 @@ func GetMyGames(c *gin.Context) {
 }
 
 // Get All Games If you were Admin
+// private games are left out unless you play in them
 func GetGames(c *gin.Context) {
+	accountID, _ := c.Get("accountID")
+
 	var games []Game
-	if err := db.Find(&games).Error; err != nil {
+	if err := visibleTo(db, accountID).Find(&games).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve Games"})
 		return
 	}
@@ -220,6 +553,23 @@ func GetGames(c *gin.Context) {
 	c.JSON(http.StatusOK, games)
 }
 
+// Leaves out the private games the viewer doesn't play in
+func visibleTo(query *gorm.DB, viewerID interface{}) *gorm.DB {
+	return query.Where("private = ? OR white_player_id = ? OR black_player_id = ?", false, viewerID, viewerID)
+}
+
+// Loads the game from the url when the account may see it,
+// a private game of other players is not found
+func loadVisibleGame(c *gin.Context, game *Game) bool {
+	accountID, _ := c.Get("accountID")
+	if err := visibleTo(db, accountID).First(game, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Game not found"})
+		return false
+	}
+
+	return true
+}
+
 // DELETE
 // Delete any Game if you were Admin
 func DeleteGame(c *gin.Context) {
@@ -249,4 +599,294 @@ func DeleteGame(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Game deleted successfully"})
-}
\ No newline at end of file
+}
+
+// GET
+// Download one game as PGN
+func GetGamePGN(c *gin.Context) {
+	var game Game
+	if !loadVisibleGame(c, &game) {
+		return
+	}
+
+	usernames := map[string]string{}
+	loadUsernames(usernames, &game)
+
+	var pgn strings.Builder
+	if err := writePGN(&pgn, &game, usernames); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", game.ID+".pgn"))
+	c.Data(http.StatusOK, "application/x-chess-pgn", []byte(pgn.String()))
+}
+
+// GET
+// Stream every game of an account as one PGN file
+// req = id(from the url), since & until (YYYY-MM-DD), category, result (win, loss or draw)
+func ExportAccountGames(c *gin.Context) {
+	accountID := c.Param("id")
+
+	viewerID, _ := c.Get("accountID")
+	query := visibleTo(db.Model(&Game{}).Where("white_player_id = ? OR black_player_id = ?", accountID, accountID), viewerID)
+
+	if since := c.Query("since"); since != "" {
+		date, err := time.Parse("2006-01-02", since)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "since must be a date like 2024-01-31"})
+			return
+		}
+		query = query.Where("start_time >= ?", date)
+	}
+
+	if until := c.Query("until"); until != "" {
+		date, err := time.Parse("2006-01-02", until)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "until must be a date like 2024-01-31"})
+			return
+		}
+		query = query.Where("start_time < ?", date.AddDate(0, 0, 1))
+	}
+
+	if category := c.Query("category"); category != "" {
+		query = query.Where("game_type = ?", category)
+	}
+
+	switch c.Query("result") {
+	case "":
+	case "win":
+		query = query.Where("winner_id = ?", accountID)
+	case "loss":
+		query = query.Where("winner_id <> '' AND winner_id <> ?", accountID)
+	case "draw":
+		query = query.Where("result = ?", Drawn)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "result must be win, loss or draw"})
+		return
+	}
+
+	rows, err := query.Order("start_time").Rows()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve Games"})
+		return
+	}
+	defer rows.Close()
+
+	c.Header("Content-Type", "application/x-chess-pgn")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", accountID+".pgn"))
+	c.Status(http.StatusOK)
+
+	usernames := map[string]string{}
+	for rows.Next() {
+		var game Game
+		if err := db.ScanRows(rows, &game); err != nil {
+			failStream(c, accountID, err)
+			return
+		}
+
+		loadUsernames(usernames, &game)
+
+		// A game with broken moves is left out instead of cutting the file
+		if err := writePGN(c.Writer, &game, usernames); err != nil {
+			continue
+		}
+		c.Writer.Flush()
+	}
+
+	if err := rows.Err(); err != nil {
+		failStream(c, accountID, err)
+	}
+}
+
+// Ends an export that could not read all its games: a 500 when nothing was
+// sent yet, otherwise the connection is cut before the end of the response
+// so the client sees an incomplete download instead of a shorter file
+func failStream(c *gin.Context, accountID string, err error) {
+	log.Printf("failed to export the games of account %s: %v", accountID, err)
+
+	if !c.Writer.Written() {
+		c.Writer.Header().Del("Content-Type")
+		c.Writer.Header().Del("Content-Disposition")
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Could not retrieve Games"})
+		return
+	}
+
+	if conn, _, err := c.Writer.Hijack(); err == nil {
+		conn.Close()
+	}
+}
+
+// POST
+// Import finished games from a PGN file, sent as the "pgn" form file or as the body
+// returns what happened to each game
+func ImportPGN(c *gin.Context) {
+	var reader io.Reader = c.Request.Body
+	if file, _, err := c.Request.FormFile("pgn"); err == nil {
+		defer file.Close()
+		reader = file
+	}
+
+	data, err := io.ReadAll(io.LimitReader(reader, 10<<20))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Could not read PGN"})
+		return
+	}
+
+	texts := splitPGN(string(data))
+	if len(texts) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No games found"})
+		return
+	}
+
+	reports := make([]ImportReport, 0, len(texts))
+	imported := 0
+
+	for i, text := range texts {
+		report := ImportReport{Index: i + 1, Status: "skipped"}
+
+		game, err := importGame(text, &report)
+		if err == nil {
+			err = db.Create(game).Error
+		}
+
+		if err != nil {
+			report.Reason = err.Error()
+		} else {
+			report.Status = "imported"
+			report.GameID = game.ID
+			imported++
+		}
+
+		reports = append(reports, report)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"imported": imported,
+		"skipped":  len(reports) - imported,
+		"games":    reports,
+	})
+}
+
+// GET
+// Every legal move of the current position, with capture, check and promotion flags
+// req = id(from the url), square (only moves from that square, from the query)
+func GetLegalMoves(c *gin.Context) {
+	var game Game
+	if !loadVisibleGame(c, &game) {
+		return
+	}
+
+	now := time.Now()
+	if _, err := saveFlag(&game, now); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	square := c.Query("square")
+	if _, ok := parseSquare(square); square != "" && !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid square"})
+		return
+	}
+
+	moves := []gin.H{}
+	if game.Status != StatusOngoing {
+		c.JSON(http.StatusOK, gin.H{"status": game.Status, "moves": moves})
+		return
+	}
+
+	pos, err := loadPosition(&game)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	plies := pos.legalPlies()
+	sort.Slice(plies, func(i, j int) bool { return plies[i].uci < plies[j].uci })
+
+	for _, played := range plies {
+		if square != "" && !strings.HasPrefix(played.uci, square) {
+			continue
+		}
+		moves = append(moves, moveInfo(played))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": game.Status, "turn": strings.ToLower(pos.turn().Name()), "moves": moves})
+}
+
+// GET
+// The position at any point of the game, the current one without a ply
+// req = id(from the url), ply (number of moves played, from the query)
+func GetPosition(c *gin.Context) {
+	var game Game
+	if !loadVisibleGame(c, &game) {
+		return
+	}
+
+	n, ok := plyFromQuery(c, &game)
+	if !ok {
+		return
+	}
+
+	pos, last, err := positionAt(&game, n)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	response := gin.H{
+		"ply":         n,
+		"fen":         pos.fen,
+		"turn":        strings.ToLower(pos.turn().Name()),
+		"castling":    orDash(pos.rights),
+		"check":       pos.inCheck(),
+		"move_number": pos.fullMoveNumber(),
+		"last_move":   nil,
+	}
+	if last != nil {
+		response["last_move"] = moveInfo(last)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// Number of plies asked with ?ply, every move of the game without it
+// writes the error response and returns false when it is not a number
+func plyFromQuery(c *gin.Context, game *Game) (int, bool) {
+	value := c.Query("ply")
+	if value == "" {
+		return len(game.Moves), true
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "ply must be a number"})
+		return 0, false
+	}
+
+	return n, true
+}
+
+// A move with the flags clients need to show it
+func moveInfo(played *ply) gin.H {
+	_, capture := capturedPiece(played)
+
+	from, to := "", ""
+	if !strings.Contains(played.uci, "@") && len(played.uci) >= 4 {
+		from, to = played.uci[:2], played.uci[2:4]
+	} else if _, target, ok := strings.Cut(played.uci, "@"); ok {
+		to = target
+	}
+
+	return gin.H{
+		"san":       played.san,
+		"uci":       played.uci,
+		"from":      from,
+		"to":        to,
+		"capture":   capture,
+		"check":     played.after.inCheck(),
+		"mate":      strings.HasSuffix(played.san, "#"),
+		"promotion": strings.Contains(played.san, "="),
+		"drop":      strings.Contains(played.uci, "@"),
+	}
+}
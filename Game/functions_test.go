@@ -0,0 +1,155 @@
+package game
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// Saves a game between alice (white) and bob after the given moves
+func gameWithMoves(t *testing.T, id string, status Status, moves ...string) {
+	t.Helper()
+
+	game := Game{ID: id, WhitePlayerID: "alice", BlackPlayerID: "bob", Status: status, Moves: moves}
+	if _, err := replayMoves(&game); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&game).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGetLegalMoves(t *testing.T) {
+	testDB(t)
+	createAccounts(t, "alice", "bob")
+
+	// White threatens Qxf7#
+	gameWithMoves(t, "game", StatusOngoing, "e4", "e5", "Qh5", "Nc6", "Bc4", "Nf6")
+	gameWithMoves(t, "finished", StatusFinished, "e4", "e5")
+
+	tests := []struct {
+		name     string
+		path     string
+		wantCode int
+		want     string
+	}{
+		{"from the knight", "/games/game/legal-moves?square=g1", http.StatusOK, "g1e2 g1f3 g1h3"},
+		{"from the queen", "/games/game/legal-moves?square=h5", http.StatusOK, "h5d1 h5e2 h5e5 h5f3 h5f5 h5f7 h5g4 h5g5 h5g6 h5h3 h5h4 h5h6 h5h7"},
+		{"from a blocked pawn", "/games/game/legal-moves?square=e4", http.StatusOK, ""},
+		{"from an empty square", "/games/game/legal-moves?square=d5", http.StatusOK, ""},
+		{"from an opponent's piece", "/games/game/legal-moves?square=f6", http.StatusOK, ""},
+		{"invalid square", "/games/game/legal-moves?square=z9", http.StatusBadRequest, ""},
+		{"finished game", "/games/finished/legal-moves", http.StatusOK, ""},
+		{"unknown game", "/games/other/legal-moves", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := apiRequest(http.MethodGet, tt.path, "alice", "")
+			if w.Code != tt.wantCode {
+				t.Fatalf("got %d %s, want %d", w.Code, w.Body.String(), tt.wantCode)
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+
+			var response struct {
+				Moves []struct {
+					UCI     string `json:"uci"`
+					Capture bool   `json:"capture"`
+					Mate    bool   `json:"mate"`
+				} `json:"moves"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, move := range response.Moves {
+				got = append(got, move.UCI)
+				if move.UCI == "h5f7" && (!move.Capture || !move.Mate) {
+					t.Errorf("Qxf7# has capture %v mate %v, want both", move.Capture, move.Mate)
+				}
+			}
+			sort.Strings(got)
+			if strings.Join(got, " ") != tt.want {
+				t.Errorf("got %v, want %s", got, tt.want)
+			}
+		})
+	}
+
+	// Every move when no square is given
+	var all struct {
+		Turn  string            `json:"turn"`
+		Moves []json.RawMessage `json:"moves"`
+	}
+	w := apiRequest(http.MethodGet, "/games/game/legal-moves", "alice", "")
+	if err := json.Unmarshal(w.Body.Bytes(), &all); err != nil {
+		t.Fatal(err)
+	}
+	if all.Turn != "white" || len(all.Moves) != 43 {
+		t.Errorf("got %d moves for %s, want 43 for white", len(all.Moves), all.Turn)
+	}
+}
+
+func TestGetPosition(t *testing.T) {
+	testDB(t)
+	createAccounts(t, "alice", "bob")
+
+	gameWithMoves(t, "check", StatusOngoing, "e4", "f5", "Qh5+")
+	gameWithMoves(t, "king", StatusOngoing, "e4", "e5", "Ke2", "Nf6", "Nf3", "Rg8")
+
+	tests := []struct {
+		name         string
+		path         string
+		wantCode     int
+		wantPly      int
+		wantCastling string
+		wantCheck    bool
+		wantLast     string
+	}{
+		{"current", "/games/check/position", http.StatusOK, 3, "KQkq", true, "Qh5+"},
+		{"start", "/games/check/position?ply=0", http.StatusOK, 0, "KQkq", false, ""},
+		{"before the check", "/games/check/position?ply=2", http.StatusOK, 2, "KQkq", false, "f5"},
+		{"last ply", "/games/check/position?ply=3", http.StatusOK, 3, "KQkq", true, "Qh5+"},
+		{"after the last ply", "/games/check/position?ply=4", http.StatusBadRequest, 0, "", false, ""},
+		{"negative ply", "/games/check/position?ply=-1", http.StatusBadRequest, 0, "", false, ""},
+		{"ply not a number", "/games/check/position?ply=two", http.StatusBadRequest, 0, "", false, ""},
+		{"white king moved", "/games/king/position?ply=3", http.StatusOK, 3, "kq", false, "Ke2"},
+		{"black rook moved", "/games/king/position", http.StatusOK, 6, "q", false, "Rg8"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := apiRequest(http.MethodGet, tt.path, "alice", "")
+			if w.Code != tt.wantCode {
+				t.Fatalf("got %d %s, want %d", w.Code, w.Body.String(), tt.wantCode)
+			}
+			if tt.wantCode != http.StatusOK {
+				return
+			}
+
+			var response struct {
+				Ply      int    `json:"ply"`
+				Castling string `json:"castling"`
+				Check    bool   `json:"check"`
+				LastMove *struct {
+					SAN string `json:"san"`
+				} `json:"last_move"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+
+			last := ""
+			if response.LastMove != nil {
+				last = response.LastMove.SAN
+			}
+			if response.Ply != tt.wantPly || response.Castling != tt.wantCastling || response.Check != tt.wantCheck || last != tt.wantLast {
+				t.Errorf("got ply %d castling %s check %v last %q, want %d %s %v %q", response.Ply, response.Castling, response.Check, last, tt.wantPly, tt.wantCastling, tt.wantCheck, tt.wantLast)
+			}
+		})
+	}
+}
@@ -0,0 +1,258 @@
+package game
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/notnil/chess"
+)
+
+var (
+	barColor     = color.RGBA{48, 46, 43, 255}
+	barTextColor = color.RGBA{250, 250, 250, 255}
+)
+
+// Every color a frame uses, so frames convert to the palette without dithering:
+// the squares, marked or not, and the white and black of the pieces with the
+// anti-aliased edges between them
+var gifPalette = func() color.Palette {
+	white, black := color.RGBA{255, 255, 255, 255}, color.RGBA{0, 0, 0, 255}
+
+	// Marks are drawn over the square at 20% opacity
+	backgrounds := []color.RGBA{lightSquare, darkSquare, white}
+	for _, mark := range []color.RGBA{lastMoveColor, checkColor} {
+		backgrounds = append(backgrounds, mixColors(lightSquare, mark, 0.2), mixColors(darkSquare, mark, 0.2))
+	}
+
+	palette := color.Palette{barColor, barTextColor, black}
+	for _, background := range backgrounds {
+		palette = append(palette, background)
+		for _, ink := range []color.RGBA{white, black} {
+			for _, share := range []float64{0.25, 0.5, 0.75} {
+				palette = append(palette, mixColors(background, ink, share))
+			}
+		}
+	}
+
+	return palette
+}()
+
+// Color between two others, share is how much of the second
+func mixColors(a color.RGBA, b color.RGBA, share float64) color.RGBA {
+	mix := func(x, y uint8) uint8 {
+		return uint8(float64(x)*(1-share) + float64(y)*share + 0.5)
+	}
+
+	return color.RGBA{mix(a.R, b.R), mix(a.G, b.G), mix(a.B, b.B), 255}
+}
+
+// What the bar above or below the board shows
+type playerBar struct {
+	name  string
+	clock string
+}
+
+// Clock written as m:ss, or h:mm:ss from an hour on
+func formatClock(ms int64) string {
+	seconds := max(ms, 0) / 1000
+	if seconds >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+	}
+
+	return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+}
+
+// Draws one frame: the board and, with bars, the players above and below it
+func drawGIFFrame(pos *position, opts boardOptions, bars *[2]playerBar) (*image.Paletted, error) {
+	size := opts.squareSize
+	board, err := drawBoard(pos, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	barHeight := 0
+	if bars != nil {
+		barHeight = size / 2
+	}
+
+	frame := image.NewPaletted(image.Rect(0, 0, 8*size, 8*size+2*barHeight), gifPalette)
+	draw.Draw(frame, frame.Bounds(), image.NewUniform(barColor), image.Point{}, draw.Src)
+	draw.Draw(frame, board.Bounds().Add(image.Pt(0, barHeight)), board, image.Point{}, draw.Src)
+
+	if bars == nil {
+		return frame, nil
+	}
+
+	textHeight := barHeight * 2 / 3
+	for i, bar := range bars {
+		middle := barHeight / 2
+		if i == 1 {
+			middle += 8*size + barHeight
+		}
+
+		nameWidth := textWidth(textHeight, bar.name)
+		drawText(frame, image.Pt(size/4+nameWidth/2, middle), textHeight, bar.name, barTextColor)
+
+		if bar.clock != "" {
+			clockWidth := textWidth(textHeight, bar.clock)
+			drawText(frame, image.Pt(8*size-size/4-clockWidth/2, middle), textHeight, bar.clock, barTextColor)
+		}
+	}
+
+	return frame, nil
+}
+
+// Integer query value within bounds, the default when it is missing
+func boundedQuery(c *gin.Context, key string, fallback int, low int, high int) (int, bool) {
+	value := c.Query(key)
+	if value == "" {
+		return fallback, true
+	}
+
+	parsed, err := strconv.Atoi(value)
+	if err != nil || parsed < low || parsed > high {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s must be between %d and %d", key, low, high)})
+		return 0, false
+	}
+
+	return parsed, true
+}
+
+// GET
+// The whole game as an animated GIF, streamed one frame at a time
+// req = id(from the url), delay & final_delay (milliseconds), flip, size, names & clocks (true or false, from the query)
+func GetGameGIF(c *gin.Context) {
+	var game Game
+	if !loadVisibleGame(c, &game) {
+		return
+	}
+
+	opts, ok := boardOptionsFrom(c)
+	if !ok {
+		return
+	}
+
+	delay, ok := boundedQuery(c, "delay", 1000, 50, 10000)
+	if !ok {
+		return
+	}
+	finalDelay, ok := boundedQuery(c, "final_delay", 3000, 50, 30000)
+	if !ok {
+		return
+	}
+
+	showNames, showClocks := true, true
+	for key, target := range map[string]*bool{"names": &showNames, "clocks": &showClocks} {
+		if value := c.Query(key); value != "" {
+			parsed, err := strconv.ParseBool(value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": key + " must be true or false"})
+				return
+			}
+			*target = parsed
+		}
+	}
+
+	start, err := startPosition(&game)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	plies, err := replayFromStart(&game)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	usernames := map[string]string{}
+	if showNames {
+		loadUsernames(usernames, &game)
+	}
+
+	// Games saved before clocks were kept per move have no clock history
+	showClocks = showClocks && isTimed(&game) && len(game.MoveClocks) == len(plies)
+	whiteClock, blackClock := int64(game.TimeControl.BaseSeconds)*1000, int64(game.TimeControl.BaseSeconds)*1000
+
+	// The top bar is black's unless the board is flipped
+	bars := func() *[2]playerBar {
+		if !showNames && !showClocks {
+			return nil
+		}
+
+		white := playerBar{}
+		black := playerBar{}
+		if showNames {
+			white.name = playerName(usernames, game.WhitePlayerID, game.WhiteName)
+			black.name = playerName(usernames, game.BlackPlayerID, game.BlackName)
+		}
+		if showClocks {
+			white.clock, black.clock = formatClock(whiteClock), formatClock(blackClock)
+		}
+
+		if opts.flip {
+			return &[2]playerBar{white, black}
+		}
+		return &[2]playerBar{black, white}
+	}
+
+	first, err := drawGIFFrame(start, opts, bars())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Header("Content-Type", "image/gif")
+	c.Header("Content-Disposition", fmt.Sprintf("inline; filename=%q", game.ID+".gif"))
+	c.Status(http.StatusOK)
+
+	stream, err := newGIFStream(c.Writer, first.Bounds(), gifPalette, c.Writer.Flush)
+	if err != nil {
+		log.Printf("failed to write the GIF of game %s: %v", game.ID, err)
+		return
+	}
+
+	// GIF delays are in hundredths of a second
+	frameDelay := func(i int) int {
+		if i == len(plies) {
+			return finalDelay / 10
+		}
+		return delay / 10
+	}
+
+	if err := stream.writeFrame(first, frameDelay(0)); err != nil {
+		log.Printf("failed to write the GIF of game %s: %v", game.ID, err)
+		return
+	}
+
+	for i, played := range plies {
+		if showClocks {
+			if played.before.turn() == chess.White {
+				whiteClock = game.MoveClocks[i]
+			} else {
+				blackClock = game.MoveClocks[i]
+			}
+		}
+
+		frameOpts := opts
+		frameOpts.highlight(played.after, played)
+
+		frame, err := drawGIFFrame(played.after, frameOpts, bars())
+		if err == nil {
+			err = stream.writeFrame(frame, frameDelay(i+1))
+		}
+		if err != nil {
+			log.Printf("failed to write the GIF of game %s: %v", game.ID, err)
+			return
+		}
+	}
+
+	if err := stream.close(); err != nil {
+		log.Printf("failed to write the GIF of game %s: %v", game.ID, err)
+	}
+}
@@ -0,0 +1,158 @@
+package game
+
+import (
+	"bufio"
+	"compress/lzw"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+)
+
+// Writes an animated GIF one frame at a time, image/gif needs every frame
+// in memory before it writes anything
+type gifStream struct {
+	w       *bufio.Writer
+	flush   func()
+	bounds  image.Rectangle
+	palette color.Palette
+	// Bits per color index, the color table has 1 << bits entries
+	bits int
+}
+
+// Writes the header, the global color table and an endless loop
+// flush is called after every frame, nil when the writer needs no flushing
+func newGIFStream(w io.Writer, bounds image.Rectangle, palette color.Palette, flush func()) (*gifStream, error) {
+	if len(palette) < 2 || len(palette) > 256 {
+		return nil, fmt.Errorf("a GIF palette needs 2 to 256 colors")
+	}
+
+	bits := 1
+	for 1<<bits < len(palette) {
+		bits++
+	}
+
+	g := &gifStream{w: bufio.NewWriter(w), flush: flush, bounds: bounds, palette: palette, bits: bits}
+
+	g.w.WriteString("GIF89a")
+	g.writeUint16(bounds.Dx())
+	g.writeUint16(bounds.Dy())
+	// Global color table, 8 bits of color resolution
+	g.w.WriteByte(0x80 | 0x70 | byte(bits-1))
+	g.w.WriteByte(0) // background color
+	g.w.WriteByte(0) // pixel aspect ratio
+
+	for i := 0; i < 1<<bits; i++ {
+		var r, gr, b uint32
+		if i < len(palette) {
+			r, gr, b, _ = palette[i].RGBA()
+		}
+		g.w.Write([]byte{byte(r >> 8), byte(gr >> 8), byte(b >> 8)})
+	}
+
+	// NETSCAPE2.0 extension: loop forever
+	g.w.Write([]byte{0x21, 0xFF, 0x0B})
+	g.w.WriteString("NETSCAPE2.0")
+	g.w.Write([]byte{0x03, 0x01, 0x00, 0x00, 0x00})
+
+	return g, g.w.Flush()
+}
+
+func (g *gifStream) writeUint16(v int) {
+	g.w.Write([]byte{byte(v), byte(v >> 8)})
+}
+
+// Writes one frame shown for delay hundredths of a second,
+// its pixels are indexes into the palette of the stream
+func (g *gifStream) writeFrame(frame *image.Paletted, delay int) error {
+	// Graphic control extension with the delay
+	g.w.Write([]byte{0x21, 0xF9, 0x04, 0x00})
+	g.writeUint16(delay)
+	g.w.Write([]byte{0x00, 0x00})
+
+	// Image descriptor covering the whole screen, using the global color table
+	g.w.WriteByte(0x2C)
+	g.writeUint16(0)
+	g.writeUint16(0)
+	g.writeUint16(g.bounds.Dx())
+	g.writeUint16(g.bounds.Dy())
+	g.w.WriteByte(0x00)
+
+	litWidth := max(g.bits, 2)
+	g.w.WriteByte(byte(litWidth))
+
+	blocks := &gifBlocks{w: g.w}
+	compressor := lzw.NewWriter(blocks, lzw.LSB, litWidth)
+
+	rect := frame.Bounds()
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		start := frame.PixOffset(rect.Min.X, y)
+		if _, err := compressor.Write(frame.Pix[start : start+rect.Dx()]); err != nil {
+			return err
+		}
+	}
+
+	if err := compressor.Close(); err != nil {
+		return err
+	}
+	if err := blocks.close(); err != nil {
+		return err
+	}
+
+	if err := g.w.Flush(); err != nil {
+		return err
+	}
+	if g.flush != nil {
+		g.flush()
+	}
+
+	return nil
+}
+
+// Writes the trailer, the stream can't be used after
+func (g *gifStream) close() error {
+	g.w.WriteByte(0x3B)
+	return g.w.Flush()
+}
+
+// Splits the compressed data in the sub-blocks of at most 255 bytes GIF expects
+type gifBlocks struct {
+	w   *bufio.Writer
+	buf [255]byte
+	n   int
+}
+
+func (b *gifBlocks) Write(p []byte) (int, error) {
+	for i := range p {
+		b.buf[b.n] = p[i]
+		b.n++
+		if b.n == len(b.buf) {
+			if err := b.writeBlock(); err != nil {
+				return i, err
+			}
+		}
+	}
+
+	return len(p), nil
+}
+
+func (b *gifBlocks) writeBlock() error {
+	if err := b.w.WriteByte(byte(b.n)); err != nil {
+		return err
+	}
+	_, err := b.w.Write(b.buf[:b.n])
+	b.n = 0
+
+	return err
+}
+
+// Writes what is left and the empty block that ends the data
+func (b *gifBlocks) close() error {
+	if b.n > 0 {
+		if err := b.writeBlock(); err != nil {
+			return err
+		}
+	}
+
+	return b.w.WriteByte(0x00)
+}
@@ -0,0 +1,96 @@
+package game
+
+import (
+	"errors"
+	"testing"
+)
+
+func hordePosition(t *testing.T, fen string) *position {
+	t.Helper()
+
+	pos, err := newPosition(fen, variantOf(&Game{Variant: VariantHorde}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pos
+}
+
+func perft(p *position, depth int) int {
+	if depth == 0 {
+		return 1
+	}
+
+	nodes := 0
+	for _, m := range p.generatedMoves() {
+		nodes += perft(p.apply(m), depth-1)
+	}
+
+	return nodes
+}
+
+// Move counts from the Horde start position, as given by other engines
+func TestHordePerft(t *testing.T) {
+	pos := hordePosition(t, hordeFEN)
+
+	for depth, want := range []int{1, 8, 128, 1274} {
+		if got := perft(pos, depth); got != want {
+			t.Errorf("depth %d: got %d moves, want %d", depth, got, want)
+		}
+	}
+}
+
+func TestHordeMoves(t *testing.T) {
+	tests := []struct {
+		name    string
+		fen     string
+		move    string
+		want    string
+		wantErr error
+	}{
+		{"first rank pawn jumps", "4k3/8/8/8/8/8/8/P7 w - - 0 1", "a1a3", "4k3/8/8/8/8/P7/8/8 b - - 0 1", nil},
+		{"first rank jump can't be taken en passant", "4k3/8/8/8/8/1p6/8/P7 w - - 0 1", "a3", "4k3/8/8/8/8/Pp6/8/8 b - - 0 1", nil},
+		{"first rank jump blocked", "4k3/8/8/8/8/8/p7/P7 w - - 0 1", "a1a3", "", errIllegalMove},
+		{"second rank jump can be taken en passant", "4k3/8/8/8/1p6/8/P7/8 w - - 0 1", "a4", "4k3/8/8/8/Pp6/8/8/8 b - a3 0 1", nil},
+		{"white has no king to leave in check", "4k3/8/8/8/8/8/8/R2q4 w - - 0 1", "Ra8+", "R3k3/8/8/8/8/8/8/3q4 b - - 1 1", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			played, err := hordePosition(t, tt.fen).play(tt.move, "")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("error %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if played.after.fen != tt.want {
+				t.Errorf("got %q, want %q", played.after.fen, tt.want)
+			}
+		})
+	}
+}
+
+func TestHordeOutcome(t *testing.T) {
+	tests := []struct {
+		name            string
+		fen             string
+		wantResult      string
+		wantTermination string
+	}{
+		{"white pieces left", "4k3/8/8/8/8/8/8/P7 b - - 0 1", "", ""},
+		{"horde destroyed", "4k3/8/8/8/8/8/8/8 w - - 0 1", BlackWins, TerminationHordeDestroyed},
+		{"white stalemated", "k7/8/8/8/8/p7/P7/8 w - - 0 1", Drawn, TerminationStalemate},
+		{"black mated", "k7/PP6/PP6/8/8/8/8/8 b - - 0 1", WhiteWins, TerminationCheckmate},
+		{"lone bishop is enough material", "4k3/8/8/8/8/8/8/B7 b - - 0 1", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, termination := detectOutcome(&Game{Variant: VariantHorde}, hordePosition(t, tt.fen))
+			if result != tt.wantResult || termination != tt.wantTermination {
+				t.Errorf("got %q %q, want %q %q", result, termination, tt.wantResult, tt.wantTermination)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package game
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+
+	account "project/Account"
+	events "project/Events"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// A fresh in memory database for the game, account and event packages
+func testDB(t *testing.T) {
+	t.Helper()
+
+	database, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every connection to :memory: is its own database
+	sqlDB, err := database.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	if err := database.AutoMigrate(&account.Account{}, &account.RatingHistory{}, &Game{}, &Challenge{}, &events.Event{}); err != nil {
+		t.Fatal(err)
+	}
+
+	Init(database)
+	account.Init(database)
+	events.Init(database)
+}
+
+func createAccounts(t *testing.T, usernames ...string) {
+	t.Helper()
+
+	for _, username := range usernames {
+		if err := db.Create(&account.Account{ID: username, Username: username, Email: username + "@example.com"}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// Sends a request to a router with the game routes of main.go, as the
+// given account or unauthenticated when it is empty
+func apiRequest(method string, path string, accountID string, body string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/games", CreateGame)
+
+	protected := router.Group("/")
+	protected.Use(func(c *gin.Context) {
+		if accountID != "" {
+			c.Set("accountID", accountID)
+		}
+	})
+	protected.POST("/games/:id/join", JoinGame)
+	protected.POST("/games/:id/abort", AbortGame)
+	protected.POST("/games/:id/move", MakeMove)
+	protected.POST("/games/:id/draw", OfferDraw)
+	protected.POST("/games/:id/draw/accept", AcceptDraw)
+	protected.POST("/games/:id/draw/decline", DeclineDraw)
+	protected.POST("/games/:id/takeback", RequestTakeback)
+	protected.POST("/games/:id/takeback/accept", AcceptTakeback)
+	protected.POST("/games/:id/takeback/decline", DeclineTakeback)
+	protected.GET("/games/:id/moves", GetMoves)
+	protected.GET("/games/:id/legal-moves", GetLegalMoves)
+	protected.GET("/games/:id/position", GetPosition)
+	protected.POST("/analysis", AnalyzePosition)
+	protected.POST("/games/import", ImportPGN)
+	protected.POST("/vacation", StartVacation)
+	protected.DELETE("/vacation", EndVacation)
+	protected.POST("/challenges/:id/accept", AcceptChallenge)
+	protected.POST("/challenges/open/:token", ClaimOpenChallenge)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+
+	return w
+}
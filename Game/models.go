@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"time"
+
+	"gorm.io/gorm"
 )
 
 type StringArray []string
@@ -16,27 +18,204 @@ func (a StringArray) Value() (driver.Value, error) {
 
 // Scan implements the sql.Scanner interface (for retrieving from DB)
 func (a *StringArray) Scan(value interface{}) error {
+	if value == nil {
+		*a = nil
+		return nil
+	}
+
 	bytes, ok := value.([]byte)
 	if !ok {
-		return fmt.Errorf("failed to convert value to byte array")
+		str, isString := value.(string)
+		if !isString {
+			return fmt.Errorf("failed to convert value to byte array")
+		}
+		bytes = []byte(str)
 	}
 
 	return json.Unmarshal(bytes, a) // Convert JSON to StringArray
 }
 
+// Numbers stored as a JSON array, like StringArray
+type Int64Array []int64
+
+func (a Int64Array) Value() (driver.Value, error) {
+	return json.Marshal(a)
+}
+
+func (a *Int64Array) Scan(value interface{}) error {
+	if value == nil {
+		*a = nil
+		return nil
+	}
+
+	bytes, ok := value.([]byte)
+	if !ok {
+		str, isString := value.(string)
+		if !isString {
+			return fmt.Errorf("failed to convert value to byte array")
+		}
+		bytes = []byte(str)
+	}
+
+	return json.Unmarshal(bytes, a)
+}
+
 type Game struct {
 	ID        string   `json:"id" gorm:"primary_key"`
 
-	Player1ID string   `json:"player1_id"`
-	Player2ID string   `json:"player2_id"`
+	WhitePlayerID string `json:"white_player_id"`
+	BlackPlayerID string `json:"black_player_id"`
+
+	// Names from an imported PGN, kept when a player has no account
+	WhiteName string `json:"white_name,omitempty"`
+	BlackName string `json:"black_name,omitempty"`
 
 	Moves     StringArray `json:"moves" gorm:"type:json"`
 
+	// Standard, Chess960 (with the number of its start position) or from a given FEN
+	Variant    string `json:"variant" gorm:"default:standard"`
+	Chess960ID int    `json:"chess960_id"`
+	StartFEN   string `json:"start_fen"`
+
+	// Boards of a bughouse match share a BughouseID, Pocket holds the pieces
+	// each side can drop, written with FEN letters ("NPp")
+	BughouseID    string `json:"bughouse_id,omitempty" gorm:"index"`
+	BughouseBoard int    `json:"bughouse_board,omitempty"`
+	PartnerGameID string `json:"partner_game_id,omitempty"`
+	Pocket        string `json:"pocket"`
+
+	// Current position and the hash of every position reached, for repetitions
+	FEN            string      `json:"fen"`
+	PositionHashes StringArray `json:"-" gorm:"type:json"`
+
 	StartTime time.Time `json:"start_time"`
 	EndTime   time.Time `json:"end_time"`
 	
-    Status    string    `json:"status"`
+    Status    Status    `json:"status"`
+	Result      string `json:"result"`
+	Termination string `json:"termination"`
+	WinnerID    string `json:"winner_id"`
+
+	// Pending offers, cancelled by the next move
+	DrawOfferBy string `json:"draw_offer_by"`
+	TakebackBy  string `json:"takeback_by"`
 	
+	// GameTime is the base time in seconds and GameType its rating category
     GameTime  int       `json:"game_time"`
 	GameType  string    `json:"game_type"`
-}
\ No newline at end of file
+
+	TimeControl TimeControl `json:"time_control" gorm:"embedded;embeddedPrefix:tc_"`
+
+	// Ratings in the GameType category, updated when a rated game ends
+	Rated             bool `json:"rated"`
+	WhiteRatingBefore int  `json:"white_rating_before"`
+	WhiteRatingAfter  int  `json:"white_rating_after"`
+	BlackRatingBefore int  `json:"black_rating_before"`
+	BlackRatingAfter  int  `json:"black_rating_after"`
+
+	// Remaining time of each player in milliseconds
+	WhiteClock int64     `json:"white_clock"`
+	BlackClock int64     `json:"black_clock"`
+	LastMoveAt time.Time `json:"last_move_at"`
+
+	// Remaining time of the mover after each move, in milliseconds
+	MoveClocks Int64Array `json:"move_clocks" gorm:"type:json"`
+
+	// Correspondence games give each move DaysPerMove days instead of a clock,
+	// the player to move loses at MoveDeadline and is reminded once before
+	DaysPerMove  int       `json:"days_per_move,omitempty"`
+	MoveDeadline time.Time `json:"move_deadline,omitempty"`
+	ReminderSent bool      `json:"-"`
+
+	// Private games are only listed for their players
+	Private bool `json:"private" gorm:"default:false"`
+
+	// The row as it was loaded, a change is only saved while it still is
+	loaded gameVersion
+}
+
+// Status and number of moves of a loaded game, see updateGame
+type gameVersion struct {
+	status Status
+	plies  int
+}
+
+func (g *Game) AfterFind(tx *gorm.DB) error {
+	g.loaded = gameVersion{status: g.Status, plies: len(g.Moves)}
+	return nil
+}
+
+// Color of a player in the game, empty if they are not playing
+func (g *Game) ColorOf(accountID string) string {
+	switch accountID {
+	case g.WhitePlayerID:
+		return "white"
+	case g.BlackPlayerID:
+		return "black"
+	}
+
+	return ""
+}
+
+// Account that has to play the next move
+func (g *Game) PlayerToMove() string {
+	if whiteToMove(g) {
+		return g.WhitePlayerID
+	}
+
+	return g.BlackPlayerID
+}
+
+// A player waiting in the pool to be paired, removed once paired or cancelled
+type Seek struct {
+	ID        string `json:"id" gorm:"primaryKey"`
+	AccountID string `json:"account_id" gorm:"index"`
+	Username  string `json:"username"`
+
+	TimeControl TimeControl `json:"time_control" gorm:"embedded;embeddedPrefix:tc_"`
+	Variant     string      `json:"variant"`
+	Rated       bool        `json:"rated"`
+	Color       string      `json:"color"` // white, black or random
+
+	// Rating of the player in the category of the seek when it was posted
+	Rating int `json:"rating"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Challenge statuses, only a pending challenge can be answered
+const (
+	ChallengePending   = "pending"
+	ChallengeAccepted  = "accepted"
+	ChallengeDeclined  = "declined"
+	ChallengeCancelled = "cancelled"
+	ChallengeExpired   = "expired"
+)
+
+// A game offered by one player to another, the game is created on accept
+// a challenge with a token is an open link, claimed by the first player
+// who opens it unless it names its opponent
+type Challenge struct {
+	ID             string `json:"id" gorm:"primaryKey"`
+	ChallengerID   string `json:"challenger_id" gorm:"index"`
+	ChallengerName string `json:"challenger_name"`
+	OpponentID     string `json:"opponent_id" gorm:"index"`
+	OpponentName   string `json:"opponent_name"`
+
+	TimeControl TimeControl `json:"time_control" gorm:"embedded;embeddedPrefix:tc_"`
+	Variant     string      `json:"variant"`
+	FEN         string      `json:"fen,omitempty"` // start of a from_position game
+	Rated       bool        `json:"rated"`
+	Color       string      `json:"color"` // of the challenger: white, black or random
+	Private     bool        `json:"private"`
+	DaysPerMove int         `json:"days_per_move,omitempty"` // a correspondence game instead of the time control
+
+	Token string `json:"token,omitempty" gorm:"index"`
+
+	Status        string `json:"status" gorm:"index"`
+	DeclineReason string `json:"decline_reason,omitempty"`
+	GameID        string `json:"game_id,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
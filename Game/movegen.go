@@ -0,0 +1,389 @@
+package game
+
+import (
+	"strings"
+
+	"github.com/notnil/chess"
+)
+
+// Move generation for variants the chess package can't play,
+// like Horde where white has no king
+
+// A move found by the generator
+type genMove struct {
+	from   chess.Square
+	to     chess.Square
+	promo  chess.PieceType
+	castle bool
+}
+
+var promotionTypes = []chess.PieceType{chess.Queen, chess.Rook, chess.Bishop, chess.Knight}
+
+var pieceLetters = map[chess.PieceType]string{
+	chess.King:   "K",
+	chess.Queen:  "Q",
+	chess.Rook:   "R",
+	chess.Bishop: "B",
+	chess.Knight: "N",
+}
+
+func (p *position) occupied(sq chess.Square) (chess.Piece, bool) {
+	piece, ok := p.squares[sq]
+	return piece, ok && piece != chess.NoPiece
+}
+
+// Moves of the side to move, including the ones that leave its king in check
+func (p *position) pseudoMoves() []genMove {
+	color := p.color
+	var moves []genMove
+
+	for from, piece := range p.squares {
+		if piece == chess.NoPiece || piece.Color() != color {
+			continue
+		}
+
+		switch piece.Type() {
+		case chess.Pawn:
+			moves = append(moves, p.pawnMoves(from)...)
+		case chess.Knight:
+			moves = append(moves, p.stepMoves(from, knightJumps)...)
+		case chess.King:
+			moves = append(moves, p.stepMoves(from, kingSteps)...)
+		case chess.Bishop:
+			moves = append(moves, p.slideMoves(from, bishopRays)...)
+		case chess.Rook:
+			moves = append(moves, p.slideMoves(from, rookRays)...)
+		case chess.Queen:
+			moves = append(moves, p.slideMoves(from, rookRays)...)
+			moves = append(moves, p.slideMoves(from, bishopRays)...)
+		}
+	}
+
+	return append(moves, p.castleMoves()...)
+}
+
+func (p *position) pawnMoves(from chess.Square) []genMove {
+	color := p.color
+	dir, startRank, lastRank := 1, chess.Rank2, chess.Rank8
+	if color == chess.Black {
+		dir, startRank, lastRank = -1, chess.Rank7, chess.Rank1
+	}
+
+	var moves []genMove
+	add := func(to chess.Square) {
+		if to.Rank() != lastRank {
+			moves = append(moves, genMove{from: from, to: to})
+			return
+		}
+		for _, promo := range promotionTypes {
+			moves = append(moves, genMove{from: from, to: to, promo: promo})
+		}
+	}
+
+	if to, ok := offsetSquare(from, 0, dir); ok {
+		if _, taken := p.occupied(to); !taken {
+			add(to)
+
+			// Horde pawns on the first rank may also jump two squares
+			jumps := from.Rank() == startRank || (p.rules.name() == VariantHorde && color == chess.White && from.Rank() == chess.Rank1)
+			if jump, ok := offsetSquare(to, 0, dir); ok && jumps {
+				if _, taken := p.occupied(jump); !taken {
+					add(jump)
+				}
+			}
+		}
+	}
+
+	for _, df := range []int{-1, 1} {
+		to, ok := offsetSquare(from, df, dir)
+		if !ok {
+			continue
+		}
+		if target, taken := p.occupied(to); (taken && target.Color() != color) || to == p.enPassant {
+			add(to)
+		}
+	}
+
+	return moves
+}
+
+func (p *position) stepMoves(from chess.Square, steps [][2]int) []genMove {
+	var moves []genMove
+	for _, step := range steps {
+		to, ok := offsetSquare(from, step[0], step[1])
+		if !ok {
+			continue
+		}
+		if target, taken := p.occupied(to); !taken || target.Color() != p.color {
+			moves = append(moves, genMove{from: from, to: to})
+		}
+	}
+
+	return moves
+}
+
+func (p *position) slideMoves(from chess.Square, rays [][2]int) []genMove {
+	var moves []genMove
+	for _, ray := range rays {
+		to, ok := offsetSquare(from, ray[0], ray[1])
+		for ok {
+			target, taken := p.occupied(to)
+			if taken && target.Color() == p.color {
+				break
+			}
+			moves = append(moves, genMove{from: from, to: to})
+			if taken {
+				break
+			}
+			to, ok = offsetSquare(to, ray[0], ray[1])
+		}
+	}
+
+	return moves
+}
+
+// Standard castling from the KQkq rights
+func (p *position) castleMoves() []genMove {
+	color := p.color
+	rank := backRank(color)
+	king := chess.NewSquare(chess.FileE, rank)
+
+	if p.squares[king] != chess.NewPiece(chess.King, color) || p.inCheck() {
+		return nil
+	}
+
+	sides := []struct {
+		letter rune
+		rook   chess.File
+		empty  []chess.File
+		passes []chess.File
+	}{
+		{'K', chess.FileH, []chess.File{chess.FileF, chess.FileG}, []chess.File{chess.FileF, chess.FileG}},
+		{'Q', chess.FileA, []chess.File{chess.FileB, chess.FileC, chess.FileD}, []chess.File{chess.FileD, chess.FileC}},
+	}
+
+	var moves []genMove
+	for _, side := range sides {
+		letter := side.letter
+		if color == chess.Black {
+			letter += 'a' - 'A'
+		}
+		if !strings.ContainsRune(p.rights, letter) || p.squares[chess.NewSquare(side.rook, rank)] != chess.NewPiece(chess.Rook, color) {
+			continue
+		}
+
+		allowed := true
+		for _, file := range side.empty {
+			if _, taken := p.occupied(chess.NewSquare(file, rank)); taken {
+				allowed = false
+			}
+		}
+		for _, file := range side.passes {
+			if squareAttacked(p.squares, chess.NewSquare(file, rank), color.Other()) {
+				allowed = false
+			}
+		}
+
+		if allowed {
+			moves = append(moves, genMove{from: king, to: chess.NewSquare(side.passes[1], rank), castle: true})
+		}
+	}
+
+	return moves
+}
+
+// Position after a generated move
+func (p *position) apply(m genMove) *position {
+	color := p.color
+	piece := p.squares[m.from]
+	_, captured := p.occupied(m.to)
+
+	next := &position{
+		rules:     p.rules,
+		squares:   make(map[chess.Square]chess.Piece, len(p.squares)),
+		color:     color.Other(),
+		enPassant: chess.NoSquare,
+		halfMoves: p.halfMoves + 1,
+		fullMoves: p.fullMoves,
+		extra:     p.extra,
+
+		pocket:       p.pocket,
+		tracksPocket: p.tracksPocket,
+	}
+	for sq, pc := range p.squares {
+		next.squares[sq] = pc
+	}
+	if color == chess.Black {
+		next.fullMoves++
+	}
+
+	delete(next.squares, m.from)
+	next.squares[m.to] = piece
+	if m.promo != chess.NoPieceType {
+		next.squares[m.to] = chess.NewPiece(m.promo, color)
+	}
+
+	if piece.Type() == chess.Pawn {
+		next.halfMoves = 0
+
+		if m.to == p.enPassant {
+			delete(next.squares, chess.NewSquare(m.to.File(), m.from.Rank()))
+		}
+
+		// Only jumps from the usual rank can be taken en passant
+		if m.from.Rank() == chess.Rank2 && m.to.Rank() == chess.Rank4 || m.from.Rank() == chess.Rank7 && m.to.Rank() == chess.Rank5 {
+			next.enPassant = chess.NewSquare(m.from.File(), (m.from.Rank()+m.to.Rank())/2)
+		}
+	}
+	if captured {
+		next.halfMoves = 0
+	}
+
+	if m.castle {
+		rank := m.from.Rank()
+		rookFrom, rookTo := chess.NewSquare(chess.FileH, rank), chess.NewSquare(chess.FileF, rank)
+		if m.to.File() == chess.FileC {
+			rookFrom, rookTo = chess.NewSquare(chess.FileA, rank), chess.NewSquare(chess.FileD, rank)
+		}
+		delete(next.squares, rookFrom)
+		next.squares[rookTo] = chess.NewPiece(chess.Rook, color)
+	}
+
+	// Rights are lost when the king or a rook moves, or a rook is taken
+	for _, letter := range p.rights {
+		letterColor, rank := chess.White, chess.Rank1
+		if letter >= 'a' {
+			letterColor, rank = chess.Black, chess.Rank8
+		}
+		rook := chess.NewSquare(chess.FileH, rank)
+		if letter == 'Q' || letter == 'q' {
+			rook = chess.NewSquare(chess.FileA, rank)
+		}
+
+		if (letterColor == color && piece.Type() == chess.King) || m.from == rook || m.to == rook {
+			continue
+		}
+		next.rights += string(letter)
+	}
+
+	next.fen = next.encode()
+	return next
+}
+
+// Moves that don't leave the mover's king in check, when it has one
+func (p *position) generatedMoves() []genMove {
+	var legal []genMove
+	for _, m := range p.pseudoMoves() {
+		after := p.apply(m)
+		king, ok := kingSquare(after.squares, p.color)
+		if ok && squareAttacked(after.squares, king, p.color.Other()) {
+			continue
+		}
+		legal = append(legal, m)
+	}
+
+	return legal
+}
+
+// Plays a move by comparing it with every generated move written in each notation
+func (p *position) playGenerated(moveStr string, notation string) (*ply, error) {
+	clean := strings.TrimRight(strings.ReplaceAll(moveStr, "0", "O"), "+#!?")
+
+	legal := p.generatedMoves()
+	for _, m := range legal {
+		played := p.generatedPly(m, legal)
+		for name := range notations {
+			if notation != "" && name != notation {
+				continue
+			}
+			if strings.TrimRight(played.encode(name), "+#") == clean {
+				return played, nil
+			}
+		}
+	}
+
+	return nil, errIllegalMove
+}
+
+func (p *position) generatedPly(m genMove, legal []genMove) *ply {
+	piece := p.squares[m.from]
+	after := p.apply(m)
+
+	_, capture := p.occupied(m.to)
+	if piece.Type() == chess.Pawn && m.to == p.enPassant {
+		capture = true
+	}
+
+	check := ""
+	if after.inCheck() {
+		check = "+"
+		if !after.hasLegalMove() {
+			check = "#"
+		}
+	}
+
+	promo := ""
+	if m.promo != chess.NoPieceType {
+		promo = pieceLetters[m.promo]
+	}
+
+	played := &ply{
+		before: p,
+		after:  after,
+		uci:    m.from.String() + m.to.String() + strings.ToLower(promo),
+	}
+
+	if m.castle {
+		played.san = "O-O" + check
+		if m.to.File() == chess.FileC {
+			played.san = "O-O-O" + check
+		}
+		played.lan = played.san
+		return played
+	}
+
+	captureMark := ""
+	if capture {
+		captureMark = "x"
+	}
+	if promo != "" {
+		promo = "=" + promo
+	}
+
+	letter := pieceLetters[piece.Type()]
+	played.lan = letter + m.from.String() + captureMark + m.to.String() + promo + check
+
+	if piece.Type() == chess.Pawn {
+		prefix := ""
+		if capture {
+			prefix = m.from.File().String() + "x"
+		}
+		played.san = prefix + m.to.String() + promo + check
+		return played
+	}
+
+	// Name the file, the rank or both when another piece of the same kind can reach the square
+	sameFile, sameRank, ambiguous := false, false, false
+	for _, other := range legal {
+		if other.to != m.to || other.from == m.from || p.squares[other.from] != piece {
+			continue
+		}
+		ambiguous = true
+		sameFile = sameFile || other.from.File() == m.from.File()
+		sameRank = sameRank || other.from.Rank() == m.from.Rank()
+	}
+
+	from := ""
+	switch {
+	case !ambiguous:
+	case !sameFile:
+		from = m.from.File().String()
+	case !sameRank:
+		from = m.from.Rank().String()
+	default:
+		from = m.from.String()
+	}
+
+	played.san = letter + from + captureMark + m.to.String() + check
+	return played
+}
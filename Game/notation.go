@@ -0,0 +1,78 @@
+package game
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/notnil/chess"
+)
+
+// Moves are stored in SAN, the others are accepted and returned on request
+var notations = map[string]chess.Notation{
+	"san": chess.AlgebraicNotation{},
+	"uci": chess.UCINotation{},
+	"lan": chess.LongAlgebraicNotation{},
+}
+
+// Tried in this order when the client does not name a notation
+var detectionOrder = []string{"san", "uci", "lan"}
+
+// Left out when comparing a move with its SAN or LAN: captures, checks,
+// annotations, the promotion sign and castling written with zeros
+var moveMarks = strings.NewReplacer("x", "", "+", "", "#", "", "!", "", "?", "", "=", "", "0", "O")
+
+// Decodes a move in the given notation, or in the first notation that fits
+func decodeMove(pos *chess.Position, moveStr string, notation string) (*chess.Move, error) {
+	if notation != "" {
+		if _, ok := notations[notation]; !ok {
+			return nil, fmt.Errorf("unknown notation %q, use san, uci or lan", notation)
+		}
+
+		return decodeAs(pos, moveStr, notation)
+	}
+
+	for _, name := range detectionOrder {
+		if move, err := decodeAs(pos, moveStr, name); err == nil {
+			return move, nil
+		}
+	}
+
+	return nil, fmt.Errorf("could not read move %q as san, uci or lan", moveStr)
+}
+
+// The SAN and LAN decoders of the chess package guess from the last square,
+// "g1f3" is read as f2-f3 and "Nfxd5" may move the other knight, so those
+// are matched against how each valid move is written instead
+func decodeAs(pos *chess.Position, moveStr string, notation string) (*chess.Move, error) {
+	if notation == "uci" {
+		return notations[notation].Decode(pos, moveStr)
+	}
+
+	want := moveMarks.Replace(moveStr)
+	for _, move := range pos.ValidMoves() {
+		if moveMarks.Replace(notations[notation].Encode(pos, move)) == want {
+			return move, nil
+		}
+	}
+
+	return nil, fmt.Errorf("could not decode %s move %q", notation, moveStr)
+}
+
+// Every move of the game written in another notation
+func encodeMoves(game *Game, notation string) ([]string, error) {
+	if _, ok := notations[notation]; !ok {
+		return nil, fmt.Errorf("unknown notation %q, use san, uci or lan", notation)
+	}
+
+	plies, err := replayFromStart(game)
+	if err != nil {
+		return nil, err
+	}
+
+	moves := make([]string, 0, len(plies))
+	for _, played := range plies {
+		moves = append(moves, played.encode(notation))
+	}
+
+	return moves, nil
+}
@@ -0,0 +1,119 @@
+package game
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/notnil/chess"
+)
+
+func TestDecodeMove(t *testing.T) {
+	// White can take on d5 with either knight
+	const knights = "rnbqkb1r/ppp1pppp/8/3p4/8/2N1N3/PPPPPPPP/R1BQKB1R w KQkq - 0 4"
+
+	tests := []struct {
+		name     string
+		fen      string
+		move     string
+		notation string
+		want     string
+		wantErr  string
+	}{
+		{"san", startingFEN, "e4", "", "e2e4", ""},
+		{"san with a check mark", "4k3/8/8/8/8/8/8/R3K3 w - - 0 1", "Ra8+", "", "a1a8", ""},
+		{"san without its marks", "4k3/8/8/8/8/8/8/R3K3 w - - 0 1", "Ra8", "", "a1a8", ""},
+		{"castling with zeros", "r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", "0-0-0", "", "e1c1", ""},
+		{"san promotion", "8/4P3/8/8/8/8/k7/4K3 w - - 0 1", "e8=Q", "", "e7e8q", ""},
+		{"uci", startingFEN, "g1f3", "", "g1f3", ""},
+		{"uci promotion", "8/4P3/8/8/8/8/k7/4K3 w - - 0 1", "e7e8n", "", "e7e8n", ""},
+		{"lan", startingFEN, "Ng1f3", "", "g1f3", ""},
+		{"pawn move in uci and lan", startingFEN, "e2e4", "", "e2e4", ""},
+		{"capture in san", knights, "Nexd5", "", "e3d5", ""},
+		{"capture in uci", knights, "c3d5", "", "c3d5", ""},
+		{"capture in lan", knights, "Nc3xd5", "", "c3d5", ""},
+		{"ambiguous san", knights, "Nxd5", "", "", "could not read move"},
+
+		{"named san", startingFEN, "Nf3", "san", "g1f3", ""},
+		{"named uci", startingFEN, "g1f3", "uci", "g1f3", ""},
+		{"named lan", startingFEN, "Ng1f3", "lan", "g1f3", ""},
+		{"uci named as san", startingFEN, "g1f3", "san", "", "could not decode san"},
+		{"over-specified san", startingFEN, "Ng1f3", "san", "", "could not decode san"},
+		{"pawn move named as lan", startingFEN, "e2e4", "lan", "e2e4", ""},
+		{"san named as uci", startingFEN, "Nf3", "uci", "", "decode"},
+		{"unknown notation", startingFEN, "e4", "fen", "", "unknown notation"},
+
+		{"illegal", startingFEN, "e5", "", "", "could not read move"},
+		{"garbage", startingFEN, "xx", "", "", "could not read move"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			option, err := chess.FEN(tt.fen)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			move, err := decodeMove(chess.NewGame(option).Position(), tt.move, tt.notation)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got %v %v, want an error with %q", move, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if move.String() != tt.want {
+				t.Errorf("got %s, want %s", move, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetMovesNotation(t *testing.T) {
+	testDB(t)
+	createAccounts(t, "alice", "bob")
+
+	game := Game{ID: "game", WhitePlayerID: "alice", BlackPlayerID: "bob", Status: StatusOngoing, Moves: StringArray{"e4", "e5", "Nf3", "Nc6", "Bb5", "a6", "Bxc6"}}
+	if _, err := replayMoves(&game); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&game).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		query    string
+		wantCode int
+		want     string
+	}{
+		{"", http.StatusOK, "e4 e5 Nf3 Nc6 Bb5 a6 Bxc6"},
+		{"?notation=san", http.StatusOK, "e4 e5 Nf3 Nc6 Bb5 a6 Bxc6"},
+		{"?notation=uci", http.StatusOK, "e2e4 e7e5 g1f3 b8c6 f1b5 a7a6 b5c6"},
+		{"?notation=lan", http.StatusOK, "e2e4 e7e5 Ng1f3 Nb8c6 Bf1b5 a7a6 Bb5xc6"},
+		{"?notation=fen", http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		w := apiRequest(http.MethodGet, "/games/game/moves"+tt.query, "alice", "")
+		if w.Code != tt.wantCode {
+			t.Errorf("%q: got %d %s, want %d", tt.query, w.Code, w.Body.String(), tt.wantCode)
+			continue
+		}
+		if tt.wantCode != http.StatusOK {
+			continue
+		}
+
+		var response struct {
+			Moves []string `json:"moves"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(response.Moves, " "); got != tt.want {
+			t.Errorf("%q: got %s, want %s", tt.query, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package game
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Loads the ongoing game from the url for one of its players
+// writes the error response and returns false when that fails
+func loadPlayerGame(c *gin.Context, game *Game, now time.Time) (string, bool) {
+	accountID, ok := loadGameOfPlayer(c, game, now)
+	if !ok {
+		return "", false
+	}
+
+	if err := game.require(StatusOngoing); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return "", false
+	}
+
+	return accountID, true
+}
+
+// loadPlayerGame for a game in any status
+func loadGameOfPlayer(c *gin.Context, game *Game, now time.Time) (string, bool) {
+	accountID, ID_exists := c.Get("accountID")
+	if !ID_exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return "", false
+	}
+
+	if err := db.First(game, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Game not found"})
+		return "", false
+	}
+
+	if game.ColorOf(accountID.(string)) == "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You are not a player in this game"})
+		return "", false
+	}
+
+	if flagged, err := saveFlag(game, now); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return "", false
+	} else if flagged {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Time is up", "game": game})
+		return "", false
+	}
+
+	return accountID.(string), true
+}
+
+// Saves the columns an action changed, 409 when the game changed since it was loaded
+func saveGame(c *gin.Context, game *Game, message string, columns ...string) {
+	if err := updateGame(game, columns...); err != nil {
+		c.JSON(updateStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+	publishGame(game, "update", message, time.Now())
+
+	c.JSON(http.StatusOK, gin.H{"message": message, "game": game})
+}
+
+// POST
+// Abort the game, only before both players have moved
+func AbortGame(c *gin.Context) {
+	now := time.Now()
+
+	// A game that has not started yet can be aborted too
+	var game Game
+	if _, ok := loadGameOfPlayer(c, &game, now); !ok {
+		return
+	}
+
+	if err := abortGame(&game, now); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	saveGame(c, &game, "Game aborted")
+}
+
+// POST
+// Resign the game
+func Resign(c *gin.Context) {
+	now := time.Now()
+
+	var game Game
+	accountID, ok := loadPlayerGame(c, &game, now)
+	if !ok {
+		return
+	}
+
+	result := WhiteWins
+	if game.ColorOf(accountID) == "white" {
+		result = BlackWins
+	}
+
+	stopClock(&game, now)
+	if err := finishGame(&game, result, TerminationResign, now); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	saveGame(c, &game, "Game resigned")
+}
+
+// POST
+// Offer a draw to the opponent
+func OfferDraw(c *gin.Context) {
+	var game Game
+	accountID, ok := loadPlayerGame(c, &game, time.Now())
+	if !ok {
+		return
+	}
+
+	if game.DrawOfferBy != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A draw offer is already pending"})
+		return
+	}
+
+	game.DrawOfferBy = accountID
+	saveGame(c, &game, "Draw offered", "draw_offer_by")
+}
+
+// POST
+// Accept the draw the opponent offered
+func AcceptDraw(c *gin.Context) {
+	now := time.Now()
+
+	var game Game
+	accountID, ok := loadPlayerGame(c, &game, now)
+	if !ok {
+		return
+	}
+
+	if game.DrawOfferBy == "" || game.DrawOfferBy == accountID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "There is no draw offer from your opponent"})
+		return
+	}
+
+	stopClock(&game, now)
+	game.DrawOfferBy = ""
+	if err := finishGame(&game, Drawn, TerminationAgreement, now); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	saveGame(c, &game, "Draw agreed")
+}
+
+// POST
+// Decline the opponent's draw offer, or take back your own
+func DeclineDraw(c *gin.Context) {
+	var game Game
+	if _, ok := loadPlayerGame(c, &game, time.Now()); !ok {
+		return
+	}
+
+	if game.DrawOfferBy == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "There is no draw offer"})
+		return
+	}
+
+	game.DrawOfferBy = ""
+	saveGame(c, &game, "Draw offer declined", "draw_offer_by")
+}
+
+// POST
+// Ask the opponent to take back your last move
+func RequestTakeback(c *gin.Context) {
+	var game Game
+	accountID, ok := loadPlayerGame(c, &game, time.Now())
+	if !ok {
+		return
+	}
+
+	// Pieces may already have been dropped on the partner board
+	if game.BughouseID != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Takebacks are not allowed in bughouse"})
+		return
+	}
+
+	if game.TakebackBy != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A takeback request is already pending"})
+		return
+	}
+
+	if takebackPlies(&game, accountID) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You have no move to take back"})
+		return
+	}
+
+	game.TakebackBy = accountID
+	saveGame(c, &game, "Takeback requested", "takeback_by")
+}
+
+// POST
+// Accept the opponent's takeback request
+func AcceptTakeback(c *gin.Context) {
+	now := time.Now()
+
+	var game Game
+	accountID, ok := loadPlayerGame(c, &game, now)
+	if !ok {
+		return
+	}
+
+	if game.TakebackBy == "" || game.TakebackBy == accountID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "There is no takeback request from your opponent"})
+		return
+	}
+
+	plies := takebackPlies(&game, game.TakebackBy)
+	if plies == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "There is no move to take back"})
+		return
+	}
+
+	stopClock(&game, now)
+	game.Moves = game.Moves[:len(game.Moves)-plies]
+	if len(game.MoveClocks) >= plies {
+		game.MoveClocks = game.MoveClocks[:len(game.MoveClocks)-plies]
+	}
+	if _, err := replayMoves(&game); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	restoreClocks(&game)
+	startMoveDeadline(&game, now)
+
+	game.TakebackBy, game.DrawOfferBy = "", ""
+	saveGame(c, &game, "Move taken back", moveColumns...)
+}
+
+// POST
+// Decline the opponent's takeback request, or cancel your own
+func DeclineTakeback(c *gin.Context) {
+	var game Game
+	if _, ok := loadPlayerGame(c, &game, time.Now()); !ok {
+		return
+	}
+
+	if game.TakebackBy == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "There is no takeback request"})
+		return
+	}
+
+	game.TakebackBy = ""
+	saveGame(c, &game, "Takeback declined", "takeback_by")
+}
+
+// Plies to undo so the player is to move again before their last move
+// 1 if the opponent has not replied yet, 2 if they have, 0 without a move
+func takebackPlies(game *Game, accountID string) int {
+	plies := 1
+	if game.PlayerToMove() == accountID {
+		plies = 2
+	}
+
+	if len(game.Moves) < plies {
+		return 0
+	}
+
+	return plies
+}
@@ -0,0 +1,142 @@
+package game
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+// One request of a player on the game
+type gameAction struct {
+	player   string
+	path     string
+	body     string
+	wantCode int
+}
+
+// A 5+0 game between alice (white) and bob after the given moves, each
+// player's clock after their moves in moveClocks
+func offersGame(t *testing.T, moves []string, moveClocks []int64) {
+	t.Helper()
+
+	now := time.Now()
+	game := Game{ID: "game", WhitePlayerID: "alice", BlackPlayerID: "bob", Status: StatusOngoing, GameTime: 300, TimeControl: TimeControl{BaseSeconds: 300}, WhiteClock: 300000, BlackClock: 300000, StartTime: now.Add(-time.Minute), LastMoveAt: now.Add(-time.Second), Moves: moves, MoveClocks: moveClocks}
+	restoreClocks(&game)
+	if _, err := replayMoves(&game); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&game).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func playActions(t *testing.T, actions []gameAction) Game {
+	t.Helper()
+
+	for i, action := range actions {
+		if w := apiRequest(http.MethodPost, "/games/game"+action.path, action.player, action.body); w.Code != action.wantCode {
+			t.Fatalf("action %d, %s%s: got %d %s, want %d", i+1, action.player, action.path, w.Code, w.Body.String(), action.wantCode)
+		}
+	}
+
+	var saved Game
+	if err := db.First(&saved, "id = ?", "game").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	return saved
+}
+
+func TestDrawOffer(t *testing.T) {
+	e4 := `{"move": "e4"}`
+
+	tests := []struct {
+		name            string
+		actions         []gameAction
+		wantStatus      Status
+		wantTermination string
+		wantOfferBy     string
+	}{
+		{"offered", []gameAction{{"alice", "/draw", "", 200}}, StatusOngoing, "", "alice"},
+		{"accepted", []gameAction{{"alice", "/draw", "", 200}, {"bob", "/draw/accept", "", 200}}, StatusFinished, TerminationAgreement, ""},
+		{"declined", []gameAction{{"alice", "/draw", "", 200}, {"bob", "/draw/decline", "", 200}}, StatusOngoing, "", ""},
+		{"withdrawn", []gameAction{{"alice", "/draw", "", 200}, {"alice", "/draw/decline", "", 200}}, StatusOngoing, "", ""},
+		{"accepted by the offerer", []gameAction{{"alice", "/draw", "", 200}, {"alice", "/draw/accept", "", 400}}, StatusOngoing, "", "alice"},
+		{"offered twice", []gameAction{{"alice", "/draw", "", 200}, {"bob", "/draw", "", 400}}, StatusOngoing, "", "alice"},
+		{"accepted without an offer", []gameAction{{"bob", "/draw/accept", "", 400}}, StatusOngoing, "", ""},
+		{"by a spectator", []gameAction{{"carol", "/draw", "", 403}}, StatusOngoing, "", ""},
+		{"expired by a move", []gameAction{{"alice", "/draw", "", 200}, {"alice", "/move", e4, 200}, {"bob", "/draw/accept", "", 400}}, StatusOngoing, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testDB(t)
+			createAccounts(t, "alice", "bob", "carol")
+			offersGame(t, nil, nil)
+
+			saved := playActions(t, tt.actions)
+			if saved.Status != tt.wantStatus || saved.Termination != tt.wantTermination || saved.DrawOfferBy != tt.wantOfferBy {
+				t.Errorf("got %s %q with offer by %q, want %s %q with offer by %q", saved.Status, saved.Termination, saved.DrawOfferBy, tt.wantStatus, tt.wantTermination, tt.wantOfferBy)
+			}
+			if tt.wantStatus == StatusFinished && saved.Result != Drawn {
+				t.Errorf("result %s, want a draw", saved.Result)
+			}
+		})
+	}
+}
+
+func TestTakeback(t *testing.T) {
+	moves := []string{"e4", "e5", "Nf3"}
+	clocks := []int64{290000, 280000, 270000}
+
+	tests := []struct {
+		name           string
+		moves          []string
+		clocks         []int64
+		actions        []gameAction
+		wantMoves      int
+		wantWhiteClock int64
+		wantBlackClock int64
+		wantTakebackBy string
+	}{
+		{"requested", moves, clocks, []gameAction{{"alice", "/takeback", "", 200}}, 3, 270000, 280000, "alice"},
+		{"of the last move", moves, clocks, []gameAction{{"alice", "/takeback", "", 200}, {"bob", "/takeback/accept", "", 200}}, 2, 290000, 280000, ""},
+		{"of a move already answered", moves, clocks, []gameAction{{"bob", "/takeback", "", 200}, {"alice", "/takeback/accept", "", 200}}, 1, 290000, 300000, ""},
+		{"of the first move", moves[:1], clocks[:1], []gameAction{{"alice", "/takeback", "", 200}, {"bob", "/takeback/accept", "", 200}}, 0, 300000, 300000, ""},
+		{"declined", moves, clocks, []gameAction{{"alice", "/takeback", "", 200}, {"bob", "/takeback/decline", "", 200}}, 3, 270000, 280000, ""},
+		{"accepted by the requester", moves, clocks, []gameAction{{"alice", "/takeback", "", 200}, {"alice", "/takeback/accept", "", 400}}, 3, 270000, 280000, "alice"},
+		{"without a move", nil, nil, []gameAction{{"alice", "/takeback", "", 400}}, 0, 300000, 300000, ""},
+		{"requested twice", moves, clocks, []gameAction{{"alice", "/takeback", "", 200}, {"bob", "/takeback", "", 400}}, 3, 270000, 280000, "alice"},
+		{"expired by a move", moves, clocks, []gameAction{{"alice", "/takeback", "", 200}, {"bob", "/move", `{"move": "Nc6"}`, 200}, {"bob", "/takeback/accept", "", 400}}, 4, 270000, -1, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testDB(t)
+			createAccounts(t, "alice", "bob")
+			offersGame(t, tt.moves, tt.clocks)
+
+			saved := playActions(t, tt.actions)
+			if len(saved.Moves) != tt.wantMoves || len(saved.MoveClocks) != tt.wantMoves || saved.TakebackBy != tt.wantTakebackBy {
+				t.Errorf("got %d moves, %d clocks, takeback by %q, want %d and %q", len(saved.Moves), len(saved.MoveClocks), saved.TakebackBy, tt.wantMoves, tt.wantTakebackBy)
+			}
+
+			// The FEN matches the moves left
+			replayed := saved
+			if _, err := replayMoves(&replayed); err != nil {
+				t.Fatal(err)
+			}
+			if saved.FEN != replayed.FEN {
+				t.Errorf("FEN %s, want %s", saved.FEN, replayed.FEN)
+			}
+
+			// A clock running since the last action only loses the time taken by the test
+			if saved.WhiteClock > tt.wantWhiteClock || saved.WhiteClock < tt.wantWhiteClock-5000 {
+				t.Errorf("white clock %d, want %d", saved.WhiteClock, tt.wantWhiteClock)
+			}
+			if tt.wantBlackClock >= 0 && (saved.BlackClock > tt.wantBlackClock || saved.BlackClock < tt.wantBlackClock-5000) {
+				t.Errorf("black clock %d, want %d", saved.BlackClock, tt.wantBlackClock)
+			}
+		})
+	}
+}
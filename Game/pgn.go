@@ -0,0 +1,154 @@
+package game
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	account "project/Account"
+
+	"github.com/notnil/chess"
+)
+
+// Writes one game in PGN with the Seven Tag Roster first
+// usernames maps account IDs to the names written in White and Black
+func writePGN(w io.Writer, game *Game, usernames map[string]string) error {
+	plies, err := replayFromStart(game)
+	if err != nil {
+		return err
+	}
+
+	result := game.Result
+	if result == "" {
+		result = string(chess.NoOutcome)
+	}
+
+	event := "Casual " + game.GameType + " game"
+	if game.Rated {
+		event = "Rated " + game.GameType + " game"
+	}
+
+	tags := [][2]string{
+		{"Event", event},
+		{"Site", "chess-api"},
+		{"Date", game.StartTime.Format("2006.01.02")},
+		{"Round", "-"},
+		{"White", playerName(usernames, game.WhitePlayerID, game.WhiteName)},
+		{"Black", playerName(usernames, game.BlackPlayerID, game.BlackName)},
+		{"Result", result},
+		{"GameId", game.ID},
+		{"UTCDate", game.StartTime.UTC().Format("2006.01.02")},
+		{"UTCTime", game.StartTime.UTC().Format("15:04:05")},
+		{"TimeControl", pgnTimeControl(game)},
+	}
+
+	if name := variantOf(game).pgnName(); name != "" {
+		tags = append(tags, [2]string{"Variant", name})
+	}
+	if game.StartFEN != "" && game.StartFEN != startingFEN {
+		tags = append(tags, [2]string{"SetUp", "1"})
+		tags = append(tags, [2]string{"FEN", game.StartFEN})
+	}
+
+	if game.WhiteRatingBefore > 0 {
+		tags = append(tags, [2]string{"WhiteElo", fmt.Sprint(game.WhiteRatingBefore)})
+		tags = append(tags, [2]string{"BlackElo", fmt.Sprint(game.BlackRatingBefore)})
+	}
+	if game.Termination != "" {
+		tags = append(tags, [2]string{"Termination", game.Termination})
+	}
+
+	buf := bufio.NewWriter(w)
+	for _, tag := range tags {
+		fmt.Fprintf(buf, "[%s \"%s\"]\n", tag[0], escapeTag(tag[1]))
+	}
+	buf.WriteString("\n")
+
+	// Movetext wrapped at 80 characters
+	line := 0
+	write := func(token string) {
+		if line > 0 && line+1+len(token) > 80 {
+			buf.WriteString("\n")
+			line = 0
+		} else if line > 0 {
+			buf.WriteString(" ")
+			line++
+		}
+		buf.WriteString(token)
+		line += len(token)
+	}
+
+	for i, played := range plies {
+		moveNumber := played.before.fullMoveNumber()
+		if played.before.turn() == chess.White {
+			write(fmt.Sprintf("%d.", moveNumber))
+		} else if i == 0 {
+			write(fmt.Sprintf("%d...", moveNumber))
+		}
+		write(played.san)
+	}
+	write(result)
+	buf.WriteString("\n\n")
+
+	return buf.Flush()
+}
+
+// PGN TimeControl tag, base and increment in seconds, a delay is written
+// with the letter of ParseTimeControl ("300d3" or "300b3") as PGN has none
+// or one move per period for correspondence
+func pgnTimeControl(game *Game) string {
+	if isCorrespondence(game) {
+		return fmt.Sprintf("1/%d", game.DaysPerMove*24*3600)
+	}
+	if !isTimed(game) {
+		return "-"
+	}
+
+	tc := game.TimeControl
+	switch tc.DelayType {
+	case SimpleDelay:
+		return fmt.Sprintf("%dd%d", game.GameTime, tc.DelaySeconds)
+	case BronsteinDelay:
+		return fmt.Sprintf("%db%d", game.GameTime, tc.DelaySeconds)
+	}
+
+	return fmt.Sprintf("%d+%d", game.GameTime, tc.IncrementSeconds)
+}
+
+func escapeTag(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value)
+}
+
+// Username of the account, or the name of an imported player without one
+func playerName(usernames map[string]string, accountID string, importedName string) string {
+	if name, ok := usernames[accountID]; ok {
+		return name
+	}
+	if importedName != "" {
+		return importedName
+	}
+
+	return "?"
+}
+
+// Adds the usernames of the players of a game that are not known yet
+func loadUsernames(usernames map[string]string, game *Game) {
+	var missing []string
+	for _, id := range []string{game.WhitePlayerID, game.BlackPlayerID} {
+		if _, ok := usernames[id]; !ok && id != "" {
+			missing = append(missing, id)
+		}
+	}
+
+	if len(missing) == 0 {
+		return
+	}
+
+	var accounts []account.Account
+	db.Select("id", "username").Where("id IN ?", missing).Find(&accounts)
+
+	for _, acc := range accounts {
+		usernames[acc.ID] = acc.Username
+	}
+}
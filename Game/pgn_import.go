@@ -0,0 +1,185 @@
+package game
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	account "project/Account"
+
+	"github.com/google/uuid"
+	"github.com/notnil/chess"
+)
+
+// What happened to one game of an uploaded PGN
+type ImportReport struct {
+	Index  int    `json:"index"`
+	White  string `json:"white"`
+	Black  string `json:"black"`
+	Result string `json:"result"`
+	Status string `json:"status"` // imported or skipped
+	Reason string `json:"reason,omitempty"`
+	GameID string `json:"game_id,omitempty"`
+}
+
+// TimeControl tag like "180+2", or "300d3" and "300b3" with a delay, all in seconds
+var pgnTimeControlRegex = regexp.MustCompile(`^(\d+)(?:([+db])(\d+))?$`)
+
+// Splits a multi-game PGN, a tag line after movetext starts the next game
+func splitPGN(text string) []string {
+	var games []string
+	var current strings.Builder
+	inMoves := false
+
+	for _, line := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+
+		if strings.HasPrefix(trimmed, "[") && inMoves {
+			games = append(games, current.String())
+			current.Reset()
+			inMoves = false
+		}
+		if trimmed != "" && !strings.HasPrefix(trimmed, "[") {
+			inMoves = true
+		}
+
+		current.WriteString(line)
+		current.WriteString("\n")
+	}
+
+	if strings.TrimSpace(current.String()) != "" {
+		games = append(games, current.String())
+	}
+
+	return games
+}
+
+// Validates one PGN game and turns it into a finished Game
+func importGame(text string, report *ImportReport) (*Game, error) {
+	pgn, err := chess.PGN(strings.NewReader(text))
+	if err != nil {
+		return nil, fmt.Errorf("could not parse game: %w", err)
+	}
+	chessGame := chess.NewGame(pgn)
+
+	tag := func(key string) string {
+		if pair := chessGame.GetTagPair(key); pair != nil {
+			return pair.Value
+		}
+		return ""
+	}
+
+	report.White, report.Black, report.Result = tag("White"), tag("Black"), tag("Result")
+
+	// The chess package only reads standard games
+	switch variant := tag("Variant"); {
+	case variant == "", strings.EqualFold(variant, "standard"), strings.EqualFold(variant, "from position"):
+	default:
+		return nil, fmt.Errorf("%s games can't be imported", variant)
+	}
+
+	switch report.Result {
+	case WhiteWins, BlackWins, Drawn:
+	default:
+		return nil, fmt.Errorf("game has no result")
+	}
+
+	if len(chessGame.Moves()) == 0 {
+		return nil, fmt.Errorf("game has no moves")
+	}
+
+	game := &Game{
+		ID:       uuid.New().String(),
+		Status:   StatusCreated,
+		GameType: Classical,
+		Variant:  VariantStandard,
+	}
+
+	game.WhitePlayerID, game.WhiteName = matchPlayer(report.White)
+	game.BlackPlayerID, game.BlackName = matchPlayer(report.Black)
+
+	if date, err := time.Parse("2006.01.02", tag("Date")); err == nil {
+		game.StartTime, game.EndTime = date, date
+	}
+
+	if parts := pgnTimeControlRegex.FindStringSubmatch(tag("TimeControl")); parts != nil {
+		baseSeconds, baseErr := strconv.Atoi(parts[1])
+		tc := TimeControl{BaseSeconds: baseSeconds}
+		if bonus, err := strconv.Atoi(parts[3]); err == nil {
+			tc.setBonus(parts[2], bonus)
+		}
+
+		if baseErr == nil && tc.Validate() == nil {
+			game.TimeControl = tc
+			game.GameTime = tc.BaseSeconds
+			game.GameType = tc.Category()
+		}
+	}
+
+	if fen := tag("FEN"); fen != "" && fen != startingFEN {
+		game.Variant, game.StartFEN = VariantFromPosition, fen
+	}
+
+	positions := chessGame.Positions()
+	for i, move := range chessGame.Moves() {
+		game.Moves = append(game.Moves, chess.AlgebraicNotation{}.Encode(positions[i], move))
+	}
+
+	// Fills in the FEN and position hashes the same way as for played games
+	if _, err := replayMoves(game); err != nil {
+		return nil, err
+	}
+
+	// Ended through the same statuses as a played game
+	termination := importTermination(tag("Termination"), report.Result, chessGame.Position().Status())
+	if err := game.transition(StatusOngoing); err != nil {
+		return nil, err
+	}
+	if err := finishGame(game, report.Result, termination, game.StartTime); err != nil {
+		return nil, err
+	}
+
+	return game, nil
+}
+
+// Termination of an imported game from its Termination tag: one written by
+// this server, or one of the PGN standard, "normal" is read from the final
+// position and the result, anything else is an adjudication
+func importTermination(tag string, result string, final chess.Method) string {
+	termination := strings.ReplaceAll(strings.ToLower(strings.TrimSpace(tag)), " ", "_")
+	if validTerminations[termination] {
+		return termination
+	}
+
+	switch termination {
+	case "", "normal":
+		switch {
+		case final == chess.Checkmate:
+			return TerminationCheckmate
+		case final == chess.Stalemate:
+			return TerminationStalemate
+		case result == Drawn:
+			return TerminationAgreement
+		}
+		return TerminationResign
+	case "time_forfeit":
+		return TerminationTimeout
+	case "abandoned":
+		return TerminationAbandonment
+	}
+
+	return TerminationAdjudication
+}
+
+// Account of a PGN player name, matched on the username without case
+// returns the name back when there is no such account
+func matchPlayer(name string) (string, string) {
+	var acc account.Account
+	if name != "" && db.Select("id").Where("LOWER(username) = LOWER(?)", name).First(&acc).Error == nil {
+		return acc.ID, ""
+	}
+
+	return "", name
+}
@@ -0,0 +1,148 @@
+package game
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/notnil/chess"
+)
+
+const scholarsMate = `[Event "Casual"]
+[White "alice"]
+[Black "Someone Else"]
+[Date "2024.03.01"]
+[TimeControl "180+2"]
+[Result "1-0"]
+
+1. e4 e5 2. Bc4 Nc6 3. Qh5 Nf6 4. Qxf7# 1-0
+`
+
+// A PGN game with the given tags and moves
+func pgnGame(result string, termination string, moves string) string {
+	text := `[White "alice"]` + "\n" + `[Black "bob"]` + "\n" + `[Result "` + result + `"]` + "\n"
+	if termination != "" {
+		text += `[Termination "` + termination + `"]` + "\n"
+	}
+
+	return text + "\n" + moves + " " + result + "\n"
+}
+
+func TestImportGame(t *testing.T) {
+	tests := []struct {
+		name            string
+		pgn             string
+		wantErr         string
+		wantResult      string
+		wantTermination string
+	}{
+		{"checkmate", scholarsMate, "", WhiteWins, TerminationCheckmate},
+		{"resigned", pgnGame(BlackWins, "", "1. e4 e5"), "", BlackWins, TerminationResign},
+		{"agreed draw", pgnGame(Drawn, "", "1. e4 e5"), "", Drawn, TerminationAgreement},
+		{"lost on time", pgnGame(WhiteWins, "time forfeit", "1. e4 e5"), "", WhiteWins, TerminationTimeout},
+		{"illegal move", pgnGame(WhiteWins, "", "1. e4 e5 2. Ke3"), "could not parse game", "", ""},
+		{"unfinished", pgnGame("*", "", "1. e4 e5"), "game has no result", "", ""},
+		{"made up result", strings.Replace(pgnGame(WhiteWins, "", "1. e4 e5"), `"1-0"`, `"2-0"`, 1), "game has no result", "", ""},
+		{"no moves", pgnGame(Drawn, "", ""), "game has no moves", "", ""},
+		{"other variant", `[Variant "Atomic"]` + "\n" + pgnGame(WhiteWins, "", "1. e4 e5"), "Atomic games can't be imported", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testDB(t)
+			createAccounts(t, "alice")
+
+			report := ImportReport{}
+			game, err := importGame(tt.pgn, &report)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if game.Status != StatusFinished || game.Result != tt.wantResult || game.Termination != tt.wantTermination {
+				t.Errorf("got %s %s %s, want finished %s %s", game.Status, game.Result, game.Termination, tt.wantResult, tt.wantTermination)
+			}
+			if game.WhitePlayerID != "alice" || game.WhiteName != "" {
+				t.Errorf("white %q %q, want the account of alice", game.WhitePlayerID, game.WhiteName)
+			}
+			if len(game.PositionHashes) != len(game.Moves)+1 {
+				t.Errorf("got %d position hashes for %d moves", len(game.PositionHashes), len(game.Moves))
+			}
+		})
+	}
+}
+
+func TestImportTermination(t *testing.T) {
+	tests := []struct {
+		tag    string
+		result string
+		final  chess.Method
+		want   string
+	}{
+		{"checkmate", WhiteWins, chess.Checkmate, TerminationCheckmate},
+		{"Threefold Repetition", Drawn, chess.NoMethod, TerminationThreefoldRepetition},
+		{"king_of_the_hill", BlackWins, chess.NoMethod, TerminationKingOfTheHill},
+		{"", WhiteWins, chess.Checkmate, TerminationCheckmate},
+		{"Normal", Drawn, chess.Stalemate, TerminationStalemate},
+		{"normal", Drawn, chess.NoMethod, TerminationAgreement},
+		{"normal", BlackWins, chess.NoMethod, TerminationResign},
+		{"time forfeit", WhiteWins, chess.NoMethod, TerminationTimeout},
+		{"abandoned", BlackWins, chess.NoMethod, TerminationAbandonment},
+		{"rules infraction", WhiteWins, chess.NoMethod, TerminationAdjudication},
+		{"unterminated", Drawn, chess.NoMethod, TerminationAdjudication},
+	}
+
+	for _, tt := range tests {
+		if got := importTermination(tt.tag, tt.result, tt.final); got != tt.want {
+			t.Errorf("%q %s: got %s, want %s", tt.tag, tt.result, got, tt.want)
+		}
+	}
+}
+
+// Each game of the file is imported or skipped on its own
+func TestImportPGN(t *testing.T) {
+	testDB(t)
+	createAccounts(t, "alice", "bob")
+
+	pgn := scholarsMate + "\n" + pgnGame(WhiteWins, "", "1. e4 e5 2. Ke3") + "\n" + pgnGame("*", "", "1. d4") + "\n" + pgnGame(Drawn, "", "1. d4 d5")
+
+	w := apiRequest(http.MethodPost, "/games/import", "alice", pgn)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got %d %s", w.Code, w.Body.String())
+	}
+
+	var response struct {
+		Imported int            `json:"imported"`
+		Skipped  int            `json:"skipped"`
+		Games    []ImportReport `json:"games"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+
+	wantStatus := []string{"imported", "skipped", "skipped", "imported"}
+	if response.Imported != 2 || response.Skipped != 2 || len(response.Games) != len(wantStatus) {
+		t.Fatalf("got %d imported and %d skipped in %+v, want 2 and 2", response.Imported, response.Skipped, response.Games)
+	}
+	for i, report := range response.Games {
+		if report.Index != i+1 || report.Status != wantStatus[i] || (report.Status == "skipped") != (report.Reason != "") {
+			t.Errorf("game %d: got %+v, want %s", i+1, report, wantStatus[i])
+		}
+	}
+
+	var saved int64
+	db.Model(&Game{}).Where("status = ?", StatusFinished).Count(&saved)
+	if saved != 2 {
+		t.Errorf("got %d saved games, want 2", saved)
+	}
+
+	if w := apiRequest(http.MethodPost, "/games/import", "alice", "  \n"); w.Code != http.StatusBadRequest {
+		t.Errorf("empty file: got %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
@@ -0,0 +1,480 @@
+package game
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+
+	"github.com/notnil/chess"
+)
+
+const startingFEN = "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"
+
+var (
+	errInvalidMove = errors.New("Invalid move format")
+	errIllegalMove = errors.New("Illegal move")
+)
+
+// A position with the rules the chess package does not know about
+type position struct {
+	// Full FEN, castling rights of Chess960 are written as rook files ("HAha")
+	// and variants may keep their own fields after the sixth
+	fen string
+	// Same position for the chess package, nil when the variant generates its own moves
+	board *chess.Position
+	rules variant
+
+	// Fields of the FEN
+	squares   map[chess.Square]chess.Piece
+	color     chess.Color
+	rights    string
+	enPassant chess.Square
+	halfMoves int
+	fullMoves int
+	extra     []string
+
+	// Pieces that can be dropped in bughouse, only checked for a position loaded from the game
+	pocket       string
+	tracksPocket bool
+}
+
+// One move played from a position
+type ply struct {
+	// nil for moves the chess package can't play, like Chess960 castling
+	move   *chess.Move
+	before *position
+	after  *position
+
+	san string
+	uci string
+	lan string
+}
+
+func newPosition(fen string, rules variant) (*position, error) {
+	p, err := parseFEN(fen)
+	if err != nil {
+		return nil, err
+	}
+	p.rules = rules
+
+	if rules.generatesMoves() {
+		return p, nil
+	}
+
+	// The chess package can't look at a position without both kings
+	kings := map[chess.Color]int{}
+	for _, piece := range p.squares {
+		if piece.Type() == chess.King {
+			kings[piece.Color()]++
+		}
+	}
+	if kings[chess.White] != 1 || kings[chess.Black] != 1 {
+		return nil, fmt.Errorf("invalid FEN %q: each side needs exactly one king", fen)
+	}
+
+	option, err := chess.FEN(rules.chessFEN(p))
+	if err != nil {
+		return nil, fmt.Errorf("invalid FEN %q: %w", fen, err)
+	}
+	p.board = chess.NewGame(option).Position()
+
+	return p, nil
+}
+
+// Reads the fields of a FEN, without checking that the position is legal
+func parseFEN(fen string) (*position, error) {
+	invalid := fmt.Errorf("invalid FEN %q", fen)
+
+	fields := strings.Fields(fen)
+	if len(fields) < 6 {
+		return nil, invalid
+	}
+
+	p := &position{
+		fen:       strings.Join(fields, " "),
+		squares:   map[chess.Square]chess.Piece{},
+		enPassant: chess.NoSquare,
+		extra:     fields[6:],
+	}
+
+	ranks := strings.Split(fields[0], "/")
+	if len(ranks) != 8 {
+		return nil, invalid
+	}
+	for i, row := range ranks {
+		rank, file := chess.Rank(7-i), 0
+		for _, letter := range row {
+			if letter >= '1' && letter <= '8' {
+				file += int(letter - '0')
+				continue
+			}
+
+			piece, ok := fenPieces[letter]
+			if !ok || file > 7 {
+				return nil, invalid
+			}
+			p.squares[chess.NewSquare(chess.File(file), rank)] = piece
+			file++
+		}
+		if file != 8 {
+			return nil, invalid
+		}
+	}
+
+	switch fields[1] {
+	case "w":
+		p.color = chess.White
+	case "b":
+		p.color = chess.Black
+	default:
+		return nil, invalid
+	}
+
+	if fields[2] != "-" {
+		p.rights = fields[2]
+	}
+
+	if fields[3] != "-" {
+		sq, ok := parseSquare(fields[3])
+		if !ok {
+			return nil, invalid
+		}
+		p.enPassant = sq
+	}
+
+	var err error
+	if p.halfMoves, err = strconv.Atoi(fields[4]); err != nil {
+		return nil, invalid
+	}
+	if p.fullMoves, err = strconv.Atoi(fields[5]); err != nil {
+		return nil, invalid
+	}
+
+	return p, nil
+}
+
+var fenPieces = map[rune]chess.Piece{
+	'K': chess.WhiteKing, 'Q': chess.WhiteQueen, 'R': chess.WhiteRook, 'B': chess.WhiteBishop, 'N': chess.WhiteKnight, 'P': chess.WhitePawn,
+	'k': chess.BlackKing, 'q': chess.BlackQueen, 'r': chess.BlackRook, 'b': chess.BlackBishop, 'n': chess.BlackKnight, 'p': chess.BlackPawn,
+}
+
+// Writes the fields back as a FEN
+func (p *position) encode() string {
+	enPassant := "-"
+	if p.enPassant != chess.NoSquare {
+		enPassant = p.enPassant.String()
+	}
+
+	fields := []string{
+		chess.NewBoard(p.squares).String(),
+		p.color.String(),
+		orDash(p.rights),
+		enPassant,
+		strconv.Itoa(p.halfMoves),
+		strconv.Itoa(p.fullMoves),
+	}
+
+	return strings.Join(append(fields, p.extra...), " ")
+}
+
+// Key of a position for repetitions: placement, turn, castling, en passant
+// and the fields a variant adds after the move counters, like the checks
+// given in three-check, the same placement with other checks is another position
+func positionHash(fen string) string {
+	fields := strings.Fields(fen)
+	key := fields[:min(4, len(fields))]
+	if len(fields) > 6 {
+		key = append(append([]string{}, key...), fields[6:]...)
+	}
+
+	hash := fnv.New64a()
+	hash.Write([]byte(strings.Join(key, " ")))
+
+	return strconv.FormatUint(hash.Sum64(), 16)
+}
+
+// FEN the game started from
+func startFEN(game *Game) string {
+	if game.StartFEN != "" {
+		return game.StartFEN
+	}
+
+	return startingFEN
+}
+
+// Position at the start of the game
+func startPosition(game *Game) (*position, error) {
+	return newPosition(startFEN(game), variantOf(game))
+}
+
+// Position saved on the game
+func loadPosition(game *Game) (*position, error) {
+	if game.FEN == "" {
+		if _, err := replayMoves(game); err != nil {
+			return nil, err
+		}
+	}
+
+	pos, err := newPosition(game.FEN, variantOf(game))
+	if err != nil {
+		return nil, fmt.Errorf("invalid saved position: %w", err)
+	}
+	pos.pocket, pos.tracksPocket = game.Pocket, game.BughouseID != ""
+
+	return pos, nil
+}
+
+// Plays the saved moves again to rebuild the FEN and the position hashes,
+// for games saved before they were stored and after a takeback
+func replayMoves(game *Game) ([]*ply, error) {
+	plies, err := replayFromStart(game)
+	if err != nil {
+		return nil, err
+	}
+
+	start, err := startPosition(game)
+	if err != nil {
+		return nil, err
+	}
+
+	game.FEN = start.fen
+	game.PositionHashes = StringArray{positionHash(start.fen)}
+	for _, played := range plies {
+		recordPosition(game, played.after)
+	}
+
+	return plies, nil
+}
+
+// Plays every saved move from the starting position
+func replayFromStart(game *Game) ([]*ply, error) {
+	pos, err := startPosition(game)
+	if err != nil {
+		return nil, err
+	}
+
+	plies := make([]*ply, 0, len(game.Moves))
+	for _, moveStr := range game.Moves {
+		played, err := pos.play(moveStr, "san")
+		if err != nil {
+			return nil, fmt.Errorf("invalid previous move: %s", moveStr)
+		}
+
+		plies = append(plies, played)
+		pos = played.after
+	}
+
+	return plies, nil
+}
+
+// Position after the first n plies of the game and the ply that reached it, nil at the start
+func positionAt(game *Game, n int) (*position, *ply, error) {
+	if n < 0 || n > len(game.Moves) {
+		return nil, nil, fmt.Errorf("ply must be between 0 and %d", len(game.Moves))
+	}
+
+	plies, err := replayFromStart(game)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if n == 0 {
+		pos, err := startPosition(game)
+		return pos, nil, err
+	}
+
+	return plies[n-1].after, plies[n-1], nil
+}
+
+// Saves the position reached by the last move
+func recordPosition(game *Game, pos *position) {
+	game.FEN = pos.fen
+	game.PositionHashes = append(game.PositionHashes, positionHash(pos.fen))
+}
+
+// How many times the current position has occurred
+func repetitions(game *Game) int {
+	if len(game.PositionHashes) == 0 {
+		return 0
+	}
+
+	last := game.PositionHashes[len(game.PositionHashes)-1]
+
+	count := 0
+	for _, hash := range game.PositionHashes {
+		if hash == last {
+			count++
+		}
+	}
+
+	return count
+}
+
+// Plays a move written in the given notation, detected when empty
+func (p *position) play(moveStr string, notation string) (*ply, error) {
+	if _, known := notations[notation]; notation != "" && !known {
+		return nil, fmt.Errorf("unknown notation %q, use san, uci or lan", notation)
+	}
+
+	if played, ok, err := p.rules.playSpecial(p, moveStr); ok {
+		return played, err
+	}
+
+	if p.board == nil {
+		return p.playGenerated(moveStr, notation)
+	}
+
+	decoded, err := decodeMove(p.board, moveStr, notation)
+	if err != nil {
+		return nil, errInvalidMove
+	}
+
+	// Only moves from the list of valid moves carry the right tags
+	var move *chess.Move
+	for _, valid := range p.board.ValidMoves() {
+		if valid.S1() == decoded.S1() && valid.S2() == decoded.S2() && valid.Promo() == decoded.Promo() {
+			move = valid
+			break
+		}
+	}
+	if move == nil {
+		return nil, errIllegalMove
+	}
+
+	return p.playMove(move)
+}
+
+// Plays a valid move of the chess package
+func (p *position) playMove(move *chess.Move) (*ply, error) {
+	board := p.board.Update(move)
+	after, err := parseFEN(board.String())
+	if err != nil {
+		return nil, err
+	}
+	after.board, after.rules = board, p.rules
+	after.pocket, after.tracksPocket = p.pocket, p.tracksPocket
+
+	p.rules.afterMove(p, after, move.S1(), move.S2())
+	after.fen = after.encode()
+
+	return &ply{
+		move:   move,
+		before: p,
+		after:  after,
+		san:    chess.AlgebraicNotation{}.Encode(p.board, move),
+		uci:    chess.UCINotation{}.Encode(p.board, move),
+		lan:    chess.LongAlgebraicNotation{}.Encode(p.board, move),
+	}, nil
+}
+
+// Every move the side to move can play
+func (p *position) legalPlies() []*ply {
+	var plies []*ply
+
+	if p.board == nil {
+		legal := p.generatedMoves()
+		for _, m := range legal {
+			plies = append(plies, p.generatedPly(m, legal))
+		}
+		return plies
+	}
+
+	for _, move := range p.board.ValidMoves() {
+		if played, err := p.playMove(move); err == nil {
+			plies = append(plies, played)
+		}
+	}
+
+	return append(plies, p.rules.specialMoves(p)...)
+}
+
+// The move written in a notation
+func (pl *ply) encode(notation string) string {
+	switch notation {
+	case "uci":
+		return pl.uci
+	case "lan":
+		return pl.lan
+	}
+
+	return pl.san
+}
+
+func (p *position) turn() chess.Color {
+	return p.color
+}
+
+func (p *position) pieces() map[chess.Square]chess.Piece {
+	pieces := make(map[chess.Square]chess.Piece, len(p.squares))
+	for sq, piece := range p.squares {
+		pieces[sq] = piece
+	}
+
+	return pieces
+}
+
+func (p *position) inCheck() bool {
+	king, ok := kingSquare(p.squares, p.color)
+
+	return ok && squareAttacked(p.squares, king, p.color.Other())
+}
+
+func (p *position) fullMoveNumber() int {
+	return p.fullMoves
+}
+
+func (p *position) halfMoveClock() int {
+	return p.halfMoves
+}
+
+func (p *position) hasLegalMove() bool {
+	if p.board == nil {
+		return len(p.generatedMoves()) > 0
+	}
+
+	return len(p.board.ValidMoves()) > 0 || len(p.rules.specialMoves(p)) > 0
+}
+
+// Checks that a FEN can start a game: one king each, the side that
+// just moved is not in check and castling rights match the pieces
+func validateStartFEN(fen string) (*position, error) {
+	// Counted on the text, the chess package can't look at a position without kings
+	placement, _, _ := strings.Cut(strings.TrimSpace(fen), " ")
+	if strings.Count(placement, "K") != 1 || strings.Count(placement, "k") != 1 {
+		return nil, fmt.Errorf("each side needs exactly one king")
+	}
+
+	pos, err := newPosition(fen, variants[VariantStandard])
+	if err != nil {
+		return nil, err
+	}
+
+	pieces := pos.pieces()
+
+	opponentKing, _ := kingSquare(pieces, pos.turn().Other())
+	if squareAttacked(pieces, opponentKing, pos.turn()) {
+		return nil, fmt.Errorf("the side not to move can't be in check")
+	}
+
+	rights := pos.board.CastleRights()
+	for _, color := range []chess.Color{chess.White, chess.Black} {
+		rank := backRank(color)
+		king := chess.NewPiece(chess.King, color)
+		rook := chess.NewPiece(chess.Rook, color)
+
+		if rights.CanCastle(color, chess.KingSide) && (pieces[chess.NewSquare(chess.FileE, rank)] != king || pieces[chess.NewSquare(chess.FileH, rank)] != rook) {
+			return nil, fmt.Errorf("castling rights don't match the king and rooks")
+		}
+		if rights.CanCastle(color, chess.QueenSide) && (pieces[chess.NewSquare(chess.FileE, rank)] != king || pieces[chess.NewSquare(chess.FileA, rank)] != rook) {
+			return nil, fmt.Errorf("castling rights don't match the king and rooks")
+		}
+	}
+
+	if !pos.hasLegalMove() {
+		return nil, fmt.Errorf("the position is already over")
+	}
+
+	return pos, nil
+}
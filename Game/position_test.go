@@ -0,0 +1,85 @@
+package game
+
+import "testing"
+
+// A standard game of the given length, every move picked the same way each
+// run among the ones that leave the opponent a legal move
+func longGame(tb testing.TB, plies int) (*Game, *position) {
+	tb.Helper()
+
+	game := &Game{Variant: VariantStandard}
+	pos, err := startPosition(game)
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	for i := 0; len(game.Moves) < plies; i++ {
+		legal := pos.legalPlies()
+
+		var next *ply
+		for j := range legal {
+			if candidate := legal[(i*7+j)%len(legal)]; candidate.after.hasLegalMove() {
+				next = candidate
+				break
+			}
+		}
+		if next == nil {
+			tb.Fatalf("no move keeps the game going after %d plies", len(game.Moves))
+		}
+
+		game.Moves = append(game.Moves, next.san)
+		pos = next.after
+	}
+
+	if _, err := replayMoves(game); err != nil {
+		tb.Fatal(err)
+	}
+
+	return game, pos
+}
+
+func TestLoadPositionMatchesReplay(t *testing.T) {
+	game, last := longGame(t, 200)
+
+	pos, err := loadPosition(game)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pos.fen != last.fen {
+		t.Errorf("loaded %q, replayed %q", pos.fen, last.fen)
+	}
+	if len(game.PositionHashes) != 201 {
+		t.Errorf("got %d position hashes, want 201", len(game.PositionHashes))
+	}
+}
+
+// Playing the next move of a 200 ply game from the saved FEN, as MakeMove
+// does, against replaying every move before it
+func BenchmarkMakeMove200Ply(b *testing.B) {
+	game, last := longGame(b, 200)
+	move := last.legalPlies()[0].san
+
+	b.Run("fen", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			pos, err := loadPosition(game)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err := pos.play(move, "san"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("replay", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			plies, err := replayFromStart(game)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err := plies[len(plies)-1].after.play(move, "san"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,283 @@
+package game
+
+import (
+	"log"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	account "project/Account"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// Rating difference accepted between two seeks, widened the longer a seek waits
+const (
+	seekBaseWindow  = 100
+	seekWindowStep  = 50
+	seekWindowEvery = 5 * time.Second
+	seekMaxWindow   = 800
+	seekPairEvery   = 2 * time.Second
+)
+
+// Pairing is done by the request posting a seek and by RunSeekPool,
+// only one of them at a time so a seek is never paired twice
+var seekMu sync.Mutex
+
+func (s *Seek) window(now time.Time) int {
+	widened := seekBaseWindow + seekWindowStep*int(now.Sub(s.CreatedAt)/seekWindowEvery)
+	return min(widened, seekMaxWindow)
+}
+
+// Same game asked for by two different players with colors that fit
+func (s *Seek) compatible(other *Seek) bool {
+	if s.AccountID == other.AccountID {
+		return false
+	}
+	if s.TimeControl != other.TimeControl || s.Variant != other.Variant || s.Rated != other.Rated {
+		return false
+	}
+
+	return s.Color == "random" || s.Color != other.Color
+}
+
+// Close enough in rating for the seek that waited the longest
+func (s *Seek) inRange(other *Seek, now time.Time) bool {
+	diff := s.Rating - other.Rating
+	if diff < 0 {
+		diff = -diff
+	}
+
+	return diff <= max(s.window(now), other.window(now))
+}
+
+// White and black of the game between two seeks
+func seekColors(s *Seek, other *Seek) (string, string) {
+	switch {
+	case s.Color == "white" || other.Color == "black":
+		return s.AccountID, other.AccountID
+	case s.Color == "black" || other.Color == "white":
+		return other.AccountID, s.AccountID
+	case rand.Intn(2) == 1:
+		return other.AccountID, s.AccountID
+	}
+
+	return s.AccountID, other.AccountID
+}
+
+// Pairs every open seek that can be paired and starts the games,
+// the seeks of a player who starts a game are all removed
+func pairSeeks(now time.Time) []*Game {
+	seekMu.Lock()
+	defer seekMu.Unlock()
+
+	var seeks []Seek
+	if err := db.Order("created_at").Find(&seeks).Error; err != nil {
+		log.Printf("failed to load the seek pool: %v", err)
+		return nil
+	}
+	if len(seeks) == 0 {
+		return nil
+	}
+
+	// Players who started a game some other way don't wait anymore
+	var accountIDs []string
+	for _, seek := range seeks {
+		accountIDs = append(accountIDs, seek.AccountID)
+	}
+	var busy []Game
+	db.Select("white_player_id", "black_player_id").Where("status = ? AND (white_player_id IN ? OR black_player_id IN ?)", StatusOngoing, accountIDs, accountIDs).Find(&busy)
+
+	playing := map[string]bool{}
+	for _, game := range busy {
+		playing[game.WhitePlayerID], playing[game.BlackPlayerID] = true, true
+	}
+
+	var games []*Game
+	for i := range seeks {
+		if playing[seeks[i].AccountID] {
+			continue
+		}
+
+		for j := i + 1; j < len(seeks); j++ {
+			if playing[seeks[j].AccountID] || !seeks[i].compatible(&seeks[j]) || !seeks[i].inRange(&seeks[j], now) {
+				continue
+			}
+
+			whiteID, blackID := seekColors(&seeks[i], &seeks[j])
+			game, err := buildGame(whiteID, blackID, gameOptions{TimeControl: seeks[i].TimeControl, Rated: seeks[i].Rated, Variant: seeks[i].Variant})
+			if err != nil {
+				log.Printf("failed to pair seeks %s and %s: %v", seeks[i].ID, seeks[j].ID, err)
+				continue
+			}
+			if _, err := startGame(game); err != nil {
+				log.Printf("failed to pair seeks %s and %s: %v", seeks[i].ID, seeks[j].ID, err)
+				continue
+			}
+
+			playing[whiteID], playing[blackID] = true, true
+			games = append(games, game)
+			break
+		}
+	}
+
+	var paired []string
+	for id := range playing {
+		paired = append(paired, id)
+	}
+	if len(paired) > 0 {
+		db.Where("account_id IN ?", paired).Delete(&Seek{})
+	}
+
+	return games
+}
+
+// Pairs the seek pool in the background so waiting seeks get paired
+// as their rating window widens, never returns
+func RunSeekPool() {
+	ticker := time.NewTicker(seekPairEvery)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		pairSeeks(now)
+	}
+}
+
+// POST
+// Wait in the pool for an opponent, paired right away when one fits
+// req = time_control, rated (true by default), color (white, black or random), variant (standard, chess960, king_of_the_hill, three_check or horde)
+func CreateSeek(c *gin.Context) {
+	accountID, ID_exists := c.Get("accountID")
+	if !ID_exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var input struct {
+		TimeControl string `json:"time_control"`
+		Rated       *bool  `json:"rated"`
+		Color       string `json:"color"`
+		Variant     string `json:"variant"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	timeControl, err := ParseTimeControl(input.TimeControl)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	switch input.Color {
+	case "":
+		input.Color = "random"
+	case "white", "black", "random":
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Color must be white, black or random"})
+		return
+	}
+
+	switch input.Variant {
+	case "":
+		input.Variant = VariantStandard
+	case VariantStandard, VariantChess960, VariantKingOfTheHill, VariantThreeCheck, VariantHorde:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Variant must be standard, chess960, king_of_the_hill, three_check or horde"})
+		return
+	}
+
+	var player account.Account
+	if err := db.First(&player, "id = ?", accountID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+		return
+	}
+
+	var ongoingGame Game
+	if err := db.Where("status = ? AND (white_player_id = ? OR black_player_id = ?)", StatusOngoing, player.ID, player.ID).First(&ongoingGame).Error; err == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You are already in an ongoing game"})
+		return
+	}
+
+	rating, _, _ := player.RatingFor(gameTypeOf(input.Variant, timeControl, 0))
+
+	seek := Seek{
+		ID:          uuid.New().String(),
+		AccountID:   player.ID,
+		Username:    player.Username,
+		TimeControl: timeControl,
+		Variant:     input.Variant,
+		Rated:       input.Rated == nil || *input.Rated,
+		Color:       input.Color,
+		Rating:      *rating,
+	}
+
+	if err := db.Create(&seek).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	for _, game := range pairSeeks(time.Now()) {
+		if game.ColorOf(player.ID) != "" {
+			c.JSON(http.StatusOK, gin.H{"game": game})
+			return
+		}
+	}
+
+	// The opponent may come later, the game_started event tells when
+	c.JSON(http.StatusCreated, gin.H{"seek": seek})
+}
+
+// GET
+// Open seeks of the pool, the oldest first
+func GetSeeks(c *gin.Context) {
+	var seeks []Seek
+	if err := db.Order("created_at").Find(&seeks).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	response := make([]gin.H, 0, len(seeks))
+	for i := range seeks {
+		response = append(response, gin.H{"seek": seeks[i], "rating_window": seeks[i].window(now)})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"seeks": response})
+}
+
+// DELETE
+// Cancel one of your seeks
+// req = id(from the url)
+func CancelSeek(c *gin.Context) {
+	accountID, ID_exists := c.Get("accountID")
+	if !ID_exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	seekMu.Lock()
+	defer seekMu.Unlock()
+
+	var seek Seek
+	if err := db.First(&seek, "id = ?", c.Param("id")).Error; err != nil {
+		// Already paired or cancelled
+		c.JSON(http.StatusNotFound, gin.H{"error": "Seek not found"})
+		return
+	}
+
+	if seek.AccountID != accountID.(string) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only cancel your own seeks"})
+		return
+	}
+
+	if err := db.Delete(&seek).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Seek cancelled"})
+}
@@ -0,0 +1,115 @@
+package game
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSeekWindow(t *testing.T) {
+	posted := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		waited time.Duration
+		want   int
+	}{
+		{0, seekBaseWindow},
+		{4999 * time.Millisecond, seekBaseWindow},
+		{seekWindowEvery, seekBaseWindow + seekWindowStep},
+		{30 * time.Second, seekBaseWindow + 6*seekWindowStep},
+		{time.Hour, seekMaxWindow},
+	}
+
+	for _, tt := range tests {
+		seek := &Seek{CreatedAt: posted}
+		if got := seek.window(posted.Add(tt.waited)); got != tt.want {
+			t.Errorf("after %v: got %d, want %d", tt.waited, got, tt.want)
+		}
+	}
+}
+
+func TestSeekInRange(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		rating int
+		waited time.Duration
+		other  int
+		want   bool
+	}{
+		{"same rating", 1500, 0, 1500, true},
+		{"edge of the base window", 1500, 0, 1600, true},
+		{"just outside the base window", 1500, 0, 1601, false},
+		{"lower rating outside the window", 1500, 0, 1399, false},
+		{"widened by waiting", 1500, 10 * time.Second, 1700, true},
+		{"never wider than the maximum", 1500, time.Hour, 2301, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			waiting := &Seek{Rating: tt.rating, CreatedAt: now.Add(-tt.waited)}
+			fresh := &Seek{Rating: tt.other, CreatedAt: now}
+
+			// The seek that waited the longest decides, whichever asks
+			if got := waiting.inRange(fresh, now); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			if got := fresh.inRange(waiting, now); got != tt.want {
+				t.Errorf("reversed: got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSeekCompatible(t *testing.T) {
+	blitz := TimeControl{BaseSeconds: 180, IncrementSeconds: 2}
+	seek := func(accountID string, color string) *Seek {
+		return &Seek{AccountID: accountID, TimeControl: blitz, Variant: VariantStandard, Rated: true, Color: color}
+	}
+
+	tests := []struct {
+		name  string
+		other *Seek
+		color string
+		want  bool
+	}{
+		{"both random", seek("b", "random"), "random", true},
+		{"opposite colors", seek("b", "black"), "white", true},
+		{"random against a color", seek("b", "white"), "random", true},
+		{"color against random", seek("b", "random"), "white", true},
+		{"same color", seek("b", "white"), "white", false},
+		{"same player", seek("a", "random"), "random", false},
+		{"other time control", &Seek{AccountID: "b", TimeControl: TimeControl{BaseSeconds: 60}, Variant: VariantStandard, Rated: true, Color: "random"}, "random", false},
+		{"other variant", &Seek{AccountID: "b", TimeControl: blitz, Variant: VariantHorde, Rated: true, Color: "random"}, "random", false},
+		{"casual against rated", &Seek{AccountID: "b", TimeControl: blitz, Variant: VariantStandard, Color: "random"}, "random", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := seek("a", tt.color).compatible(tt.other); got != tt.want {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSeekColors(t *testing.T) {
+	tests := []struct {
+		color     string
+		other     string
+		wantWhite string
+	}{
+		{"white", "random", "a"},
+		{"random", "black", "a"},
+		{"black", "random", "b"},
+		{"random", "white", "b"},
+		{"white", "black", "a"},
+	}
+
+	for _, tt := range tests {
+		white, black := seekColors(&Seek{AccountID: "a", Color: tt.color}, &Seek{AccountID: "b", Color: tt.other})
+		if white != tt.wantWhite || white == black {
+			t.Errorf("%s against %s: white %s black %s, want white %s", tt.color, tt.other, white, black, tt.wantWhite)
+		}
+	}
+}
@@ -0,0 +1,342 @@
+package game
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	account "project/Account"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	socketWriteWait  = 10 * time.Second
+	socketPongWait   = 60 * time.Second
+	socketPingPeriod = socketPongWait * 9 / 10
+	socketBuffer     = 32
+)
+
+// How long a socket ticket can be used, once
+const socketTicketTTL = 30 * time.Second
+
+var upgrader = websocket.Upgrader{
+	CheckOrigin: checkOrigin,
+}
+
+// Browsers send the page opening the socket as its Origin: only this site
+// and the ones in ALLOWED_ORIGINS (comma separated) may open one
+// other clients send no Origin
+func checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	parsed, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(parsed.Host, r.Host) {
+		return true
+	}
+
+	for _, allowed := range strings.Split(os.Getenv("ALLOWED_ORIGINS"), ",") {
+		if allowed = strings.TrimSpace(allowed); allowed != "" && strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Browsers send no Authorization header on a socket, so they open it with
+// a single use ticket in the query instead of the JWT, which would end up
+// in access logs
+type socketTicket struct {
+	accountID string
+	expires   time.Time
+}
+
+var socketTickets = struct {
+	sync.Mutex
+	byID map[string]socketTicket
+}{byID: map[string]socketTicket{}}
+
+// POST
+// A ticket to open a game socket, valid once for 30 seconds
+func CreateSocketTicket(c *gin.Context) {
+	accountID, ID_exists := c.Get("accountID")
+	if !ID_exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	now := time.Now()
+	ticket := uuid.New().String()
+
+	socketTickets.Lock()
+	for id, old := range socketTickets.byID {
+		if now.After(old.expires) {
+			delete(socketTickets.byID, id)
+		}
+	}
+	socketTickets.byID[ticket] = socketTicket{accountID: accountID.(string), expires: now.Add(socketTicketTTL)}
+	socketTickets.Unlock()
+
+	c.JSON(http.StatusOK, gin.H{"ticket": ticket, "expires_in": int(socketTicketTTL.Seconds())})
+}
+
+// Account of a ticket, which can't be used again
+func redeemSocketTicket(ticket string, now time.Time) (string, bool) {
+	socketTickets.Lock()
+	defer socketTickets.Unlock()
+
+	found, ok := socketTickets.byID[ticket]
+	delete(socketTickets.byID, ticket)
+
+	return found.accountID, ok && now.Before(found.expires)
+}
+
+// One connection watching a game, a player or a spectator
+type socketClient struct {
+	conn      *websocket.Conn
+	send      chan []byte
+	gameID    string
+	accountID string
+}
+
+// Connections of every watched game
+type gameHub struct {
+	mu      sync.Mutex
+	clients map[string]map[*socketClient]bool
+}
+
+var hub = &gameHub{clients: map[string]map[*socketClient]bool{}}
+
+// Joins and queues the game as it is now as the first message: the game
+// is loaded after joining, while holding back broadcasts, so no update
+// saved in between is missed or sent before an older state
+func (h *gameHub) joinWithState(client *socketClient) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.clients[client.gameID] == nil {
+		h.clients[client.gameID] = map[*socketClient]bool{}
+	}
+	h.clients[client.gameID][client] = true
+
+	var game Game
+	if err := db.First(&game, "id = ?", client.gameID).Error; err != nil {
+		delete(h.clients[client.gameID], client)
+		if len(h.clients[client.gameID]) == 0 {
+			delete(h.clients, client.gameID)
+		}
+		return err
+	}
+
+	client.send <- gameMessage(&game, "state", "", time.Now())
+	return nil
+}
+
+func (h *gameHub) leave(client *socketClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.clients[client.gameID][client]; !ok {
+		return
+	}
+
+	delete(h.clients[client.gameID], client)
+	close(client.send)
+	if len(h.clients[client.gameID]) == 0 {
+		delete(h.clients, client.gameID)
+	}
+}
+
+// Sends a message to everyone watching the game, a client too slow
+// to keep up is dropped instead of holding up the others
+func (h *gameHub) broadcast(gameID string, message []byte) {
+	h.mu.Lock()
+	var slow []*socketClient
+	for client := range h.clients[gameID] {
+		select {
+		case client.send <- message:
+		default:
+			slow = append(slow, client)
+		}
+	}
+	h.mu.Unlock()
+
+	for _, client := range slow {
+		h.leave(client)
+	}
+}
+
+func gameMessage(game *Game, event string, detail string, now time.Time) []byte {
+	message := gin.H{"type": event, "game": game, "clocks": clocksResponse(game, now)}
+	switch event {
+	case "move":
+		message["move"] = detail
+	default:
+		if detail != "" {
+			message["message"] = detail
+		}
+	}
+
+	data, err := json.Marshal(message)
+	if err != nil {
+		log.Printf("failed to encode the update of game %s: %v", game.ID, err)
+		return nil
+	}
+
+	return data
+}
+
+// Pushes a saved change of the game to its sockets: a move, an offer
+// or the result, a move that ends the game is followed by an "end"
+func publishGame(game *Game, event string, detail string, now time.Time) {
+	if data := gameMessage(game, event, detail, now); data != nil {
+		hub.broadcast(game.ID, data)
+	}
+
+	if event != "end" && (game.Status == StatusFinished || game.Status == StatusAborted) {
+		publishGame(game, "end", "", now)
+	}
+}
+
+// GET
+// WebSocket of one game for players and spectators
+// req = id(from the url), ticket (from POST /games/ws-ticket, in the query) or the JWT in the Authorization header
+// pushes "state" on connect then "move", "update" and "end", players can send {"type": "move", "move": "e4"}
+func GameSocket(c *gin.Context) {
+	var accountID string
+	if ticket := c.Query("ticket"); ticket != "" {
+		var ok bool
+		if accountID, ok = redeemSocketTicket(ticket, time.Now()); !ok {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired ticket"})
+			return
+		}
+	} else {
+		claims, err := account.ParseToken(strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer "))
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+			return
+		}
+		accountID = claims.ID
+	}
+
+	// Only checks the game can be watched, the state sent is loaded once joined
+	var game Game
+	if err := visibleTo(db, accountID).Select("id").First(&game, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Game not found"})
+		return
+	}
+
+	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// The upgrader already wrote the error response
+		return
+	}
+
+	client := &socketClient{conn: conn, send: make(chan []byte, socketBuffer), gameID: game.ID, accountID: accountID}
+	if err := hub.joinWithState(client); err != nil {
+		log.Printf("failed to send the state of game %s: %v", game.ID, err)
+		conn.Close()
+		return
+	}
+
+	go client.writeLoop()
+	client.readLoop()
+}
+
+// Writes queued messages and keeps the connection alive with pings
+func (client *socketClient) writeLoop() {
+	ticker := time.NewTicker(socketPingPeriod)
+	defer func() {
+		ticker.Stop()
+		client.conn.Close()
+	}()
+
+	for {
+		select {
+		case message, ok := <-client.send:
+			client.conn.SetWriteDeadline(time.Now().Add(socketWriteWait))
+			if !ok {
+				client.conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := client.conn.WriteMessage(websocket.TextMessage, message); err != nil {
+				return
+			}
+		case <-ticker.C:
+			client.conn.SetWriteDeadline(time.Now().Add(socketWriteWait))
+			if err := client.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Plays the moves sent by a player until the connection closes
+func (client *socketClient) readLoop() {
+	defer hub.leave(client)
+
+	client.conn.SetReadLimit(4096)
+	client.conn.SetReadDeadline(time.Now().Add(socketPongWait))
+	client.conn.SetPongHandler(func(string) error {
+		return client.conn.SetReadDeadline(time.Now().Add(socketPongWait))
+	})
+
+	for {
+		var input struct {
+			Type     string `json:"type"`
+			Move     string `json:"move"`
+			Notation string `json:"notation"`
+		}
+		_, data, err := client.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if err := json.Unmarshal(data, &input); err != nil {
+			client.reply(gin.H{"type": "error", "error": "Invalid message"})
+			continue
+		}
+
+		if input.Type != "move" {
+			client.reply(gin.H{"type": "error", "error": "Unknown message type, only move is accepted"})
+			continue
+		}
+
+		// Everyone watching gets the move from publishGame, only errors are answered here
+		if _, _, err := submitMove(client.gameID, client.accountID, input.Move, input.Notation, time.Now()); err != nil {
+			client.reply(gin.H{"type": "error", "error": err.Error()})
+		}
+	}
+}
+
+// Sends a message to this client only
+func (client *socketClient) reply(message gin.H) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return
+	}
+
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	// The client may already have been dropped
+	if _, ok := hub.clients[client.gameID][client]; ok {
+		select {
+		case client.send <- data:
+		default:
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package game
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// Opens the socket of a game as the account, with a fresh ticket
+func dialGame(t *testing.T, server *httptest.Server, gameID string, accountID string) (*websocket.Conn, *http.Response, error) {
+	t.Helper()
+
+	ticket := "ticket-" + accountID
+	socketTickets.Lock()
+	socketTickets.byID[ticket] = socketTicket{accountID: accountID, expires: time.Now().Add(socketTicketTTL)}
+	socketTickets.Unlock()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/games/" + gameID + "/ws?ticket=" + ticket
+	return websocket.DefaultDialer.Dial(url, nil)
+}
+
+func readMessage(t *testing.T, conn *websocket.Conn) (string, Game) {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var message struct {
+		Type string `json:"type"`
+		Game Game   `json:"game"`
+	}
+	if err := conn.ReadJSON(&message); err != nil {
+		t.Fatal(err)
+	}
+
+	return message.Type, message.Game
+}
+
+func TestGameSocket(t *testing.T) {
+	testDB(t)
+	createAccounts(t, "alice", "bob", "carol")
+
+	if err := db.Create(&Game{ID: "game", WhitePlayerID: "alice", BlackPlayerID: "bob", Status: StatusOngoing, FEN: startingFEN}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Create(&Game{ID: "private", WhitePlayerID: "alice", BlackPlayerID: "bob", Status: StatusOngoing, FEN: startingFEN, Private: true}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.GET("/games/:id/ws", GameSocket)
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	if _, resp, err := dialGame(t, server, "private", "carol"); err == nil || resp.StatusCode != http.StatusNotFound {
+		t.Errorf("private game of others: got %v, want %d", err, http.StatusNotFound)
+	}
+
+	conn, _, err := dialGame(t, server, "game", "carol")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if event, game := readMessage(t, conn); event != "state" || game.ID != "game" {
+		t.Fatalf("first message %s of %q, want the state of the game", event, game.ID)
+	}
+
+	// Joined by the time the state is sent, so the next update reaches it
+	var game Game
+	if err := db.First(&game, "id = ?", "game").Error; err != nil {
+		t.Fatal(err)
+	}
+	game.FEN = blackToMoveFEN
+	publishGame(&game, "update", "", time.Now())
+
+	if event, got := readMessage(t, conn); event != "update" || got.FEN != blackToMoveFEN {
+		t.Errorf("got %s with %s, want the update", event, got.FEN)
+	}
+
+	data, _ := json.Marshal(gin.H{"type": "hello"})
+	conn.WriteMessage(websocket.TextMessage, data)
+	if event, _ := readMessage(t, conn); event != "error" {
+		t.Errorf("unknown message: got %s, want an error", event)
+	}
+}
@@ -0,0 +1,131 @@
+package game
+
+import (
+	"fmt"
+	"time"
+)
+
+type Status string
+
+// Lifecycle of a game: created is a game built but not saved yet, it is
+// saved waiting for its opponent when only one player is known, and
+// ongoing once both are
+//
+//	created ----------------------------.
+//	   |                                 v
+//	   '-> waiting_for_opponent ----> ongoing ----> finished
+//	              |                      |
+//	              '-----> aborted <------'
+const (
+	StatusCreated  Status = "created"
+	StatusWaiting  Status = "waiting_for_opponent"
+	StatusOngoing  Status = "ongoing"
+	StatusAborted  Status = "aborted"
+	StatusFinished Status = "finished"
+)
+
+var transitions = map[Status][]Status{
+	StatusCreated: {StatusWaiting, StatusOngoing},
+	StatusWaiting: {StatusOngoing, StatusAborted},
+	StatusOngoing: {StatusFinished, StatusAborted},
+}
+
+// How a finished game ended
+const (
+	TerminationCheckmate            = "checkmate"
+	TerminationResign               = "resign"
+	TerminationTimeout              = "timeout"
+	TerminationAgreement            = "agreement"
+	TerminationStalemate            = "stalemate"
+	TerminationThreefoldRepetition  = "threefold_repetition"
+	TerminationFivefoldRepetition   = "fivefold_repetition"
+	TerminationFiftyMoveRule        = "fifty_move_rule"
+	TerminationSeventyFiveMoveRule  = "seventy_five_move_rule"
+	TerminationInsufficientMaterial = "insufficient_material"
+	TerminationAbandonment          = "abandonment"
+	TerminationAdjudication         = "adjudication"
+	TerminationKingOfTheHill        = "king_of_the_hill"
+	TerminationThreeChecks          = "three_checks"
+	TerminationHordeDestroyed       = "horde_destroyed"
+	TerminationPartnerGame          = "partner_game"
+)
+
+var validTerminations = map[string]bool{
+	TerminationCheckmate:            true,
+	TerminationResign:               true,
+	TerminationTimeout:              true,
+	TerminationAgreement:            true,
+	TerminationStalemate:            true,
+	TerminationThreefoldRepetition:  true,
+	TerminationFivefoldRepetition:   true,
+	TerminationFiftyMoveRule:        true,
+	TerminationSeventyFiveMoveRule:  true,
+	TerminationInsufficientMaterial: true,
+	TerminationAbandonment:          true,
+	TerminationAdjudication:         true,
+	TerminationKingOfTheHill:        true,
+	TerminationThreeChecks:          true,
+	TerminationHordeDestroyed:       true,
+	TerminationPartnerGame:          true,
+}
+
+// Moves the game to another status, an illegal transition is an error
+func (g *Game) transition(to Status) error {
+	for _, allowed := range transitions[g.Status] {
+		if allowed == to {
+			g.Status = to
+			return nil
+		}
+	}
+
+	return fmt.Errorf("Game is %s and can't become %s", g.Status, to)
+}
+
+// Error to show when a game is not in the status an action needs
+func (g *Game) require(status Status) error {
+	if g.Status == status {
+		return nil
+	}
+
+	switch g.Status {
+	case StatusFinished:
+		return fmt.Errorf("Game already ended")
+	case StatusAborted:
+		return fmt.Errorf("Game was aborted")
+	case StatusWaiting:
+		return fmt.Errorf("Game is waiting for an opponent")
+	}
+
+	return fmt.Errorf("Game is %s, not %s", g.Status, status)
+}
+
+// A game can be aborted until both players have moved
+func (g *Game) canAbort() bool {
+	return g.Status != StatusOngoing || len(g.Moves) < 2
+}
+
+func abortGame(game *Game, now time.Time) error {
+	if game.Status == StatusFinished || game.Status == StatusAborted {
+		return game.require(StatusOngoing)
+	}
+	if !game.canAbort() {
+		return fmt.Errorf("Game can't be aborted after both players moved")
+	}
+
+	// Both boards of a bughouse match are aborted together
+	if game.PartnerGameID != "" {
+		var partner Game
+		if err := db.First(&partner, "id = ?", game.PartnerGameID).Error; err == nil && !partner.canAbort() {
+			return fmt.Errorf("Game can't be aborted after both players moved on the partner board")
+		}
+	}
+
+	if err := game.transition(StatusAborted); err != nil {
+		return err
+	}
+
+	game.EndTime = now
+	game.DrawOfferBy, game.TakebackBy = "", ""
+
+	return nil
+}
@@ -0,0 +1,295 @@
+package game
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestTransition(t *testing.T) {
+	tests := []struct {
+		from Status
+		to   Status
+		ok   bool
+	}{
+		{StatusCreated, StatusWaiting, true},
+		{StatusCreated, StatusOngoing, true},
+		{StatusCreated, StatusAborted, false},
+		{StatusCreated, StatusFinished, false},
+		{StatusWaiting, StatusOngoing, true},
+		{StatusWaiting, StatusAborted, true},
+		{StatusWaiting, StatusFinished, false},
+		{StatusOngoing, StatusFinished, true},
+		{StatusOngoing, StatusAborted, true},
+		{StatusOngoing, StatusCreated, false},
+		{StatusFinished, StatusOngoing, false},
+		{StatusFinished, StatusAborted, false},
+		{StatusAborted, StatusOngoing, false},
+		{StatusAborted, StatusFinished, false},
+	}
+
+	for _, tt := range tests {
+		game := &Game{Status: tt.from}
+		err := game.transition(tt.to)
+
+		if (err == nil) != tt.ok {
+			t.Errorf("%s -> %s: error %v, want allowed %v", tt.from, tt.to, err, tt.ok)
+		}
+
+		want := tt.from
+		if tt.ok {
+			want = tt.to
+		}
+		if game.Status != want {
+			t.Errorf("%s -> %s: status %s, want %s", tt.from, tt.to, game.Status, want)
+		}
+	}
+}
+
+func TestRequire(t *testing.T) {
+	tests := []struct {
+		status Status
+		want   string
+	}{
+		{StatusOngoing, ""},
+		{StatusFinished, "Game already ended"},
+		{StatusAborted, "Game was aborted"},
+		{StatusWaiting, "Game is waiting for an opponent"},
+		{StatusCreated, "Game is created, not ongoing"},
+	}
+
+	for _, tt := range tests {
+		err := (&Game{Status: tt.status}).require(StatusOngoing)
+
+		got := ""
+		if err != nil {
+			got = err.Error()
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.status, got, tt.want)
+		}
+	}
+}
+
+func TestAbortGame(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		status  Status
+		moves   []string
+		wantErr string
+	}{
+		{"waiting for an opponent", StatusWaiting, nil, ""},
+		{"no moves", StatusOngoing, nil, ""},
+		{"one move", StatusOngoing, []string{"e4"}, ""},
+		{"both players moved", StatusOngoing, []string{"e4", "e5"}, "Game can't be aborted after both players moved"},
+		{"finished", StatusFinished, []string{"e4"}, "Game already ended"},
+		{"already aborted", StatusAborted, nil, "Game was aborted"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			game := &Game{Status: tt.status, Moves: tt.moves, DrawOfferBy: "white", TakebackBy: "black"}
+			err := abortGame(game, now)
+
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("error %v, want %q", err, tt.wantErr)
+				}
+				if game.Status != tt.status {
+					t.Errorf("status %s, want it unchanged", game.Status)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if game.Status != StatusAborted || !game.EndTime.Equal(now) || game.DrawOfferBy != "" || game.TakebackBy != "" {
+				t.Errorf("got %s at %v with offers %q %q, want aborted at %v without offers", game.Status, game.EndTime, game.DrawOfferBy, game.TakebackBy, now)
+			}
+		})
+	}
+}
+
+func TestFinishGame(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		status      Status
+		result      string
+		termination string
+		wantWinner  string
+		wantErr     bool
+	}{
+		{"white mates", StatusOngoing, WhiteWins, TerminationCheckmate, "white-id", false},
+		{"black on time", StatusOngoing, BlackWins, TerminationTimeout, "black-id", false},
+		{"draw", StatusOngoing, Drawn, TerminationAgreement, "", false},
+		{"unknown termination", StatusOngoing, WhiteWins, "forfeit", "", true},
+		{"already finished", StatusFinished, WhiteWins, TerminationResign, "", true},
+		{"aborted", StatusAborted, WhiteWins, TerminationResign, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			game := &Game{Status: tt.status, WhitePlayerID: "white-id", BlackPlayerID: "black-id"}
+			err := finishGame(game, tt.result, tt.termination, now)
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if game.Status != tt.status || game.Result != "" {
+					t.Errorf("got %s %q, want the game untouched", game.Status, game.Result)
+				}
+				return
+			}
+
+			if game.Status != StatusFinished || game.Result != tt.result || game.Termination != tt.termination || game.WinnerID != tt.wantWinner || !game.EndTime.Equal(now) {
+				t.Errorf("got %s %s %s winner %q, want finished %s %s winner %q", game.Status, game.Result, game.Termination, game.WinnerID, tt.result, tt.termination, tt.wantWinner)
+			}
+		})
+	}
+}
+
+// Creates a game without player2 as alice, who asked for white
+func createWaitingGame(t *testing.T) Game {
+	t.Helper()
+
+	w := apiRequest(http.MethodPost, "/games", "", `{"player1_id": "alice", "color": "white", "time_control": "5+0"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("create: got %d %s", w.Code, w.Body.String())
+	}
+
+	var created struct {
+		Game Game `json:"game"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+
+	return created.Game
+}
+
+func TestCreateGameWaitsForAnOpponent(t *testing.T) {
+	testDB(t)
+	createAccounts(t, "alice")
+
+	created := createWaitingGame(t)
+
+	var saved Game
+	if err := db.First(&saved, "id = ?", created.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if saved.Status != StatusWaiting || saved.WhitePlayerID != "alice" || saved.BlackPlayerID != "" {
+		t.Errorf("got %s between %q and %q, want waiting_for_opponent with alice as white", saved.Status, saved.WhitePlayerID, saved.BlackPlayerID)
+	}
+
+	if w := apiRequest(http.MethodPost, "/games", "", `{"color": "white", "time_control": "5+0"}`); w.Code != http.StatusBadRequest {
+		t.Errorf("without any player: got %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestJoinGame(t *testing.T) {
+	tests := []struct {
+		name     string
+		joiner   string
+		setup    func(t *testing.T, game *Game)
+		wantCode int
+	}{
+		{"by another player", "bob", nil, http.StatusOK},
+		{"by its creator", "alice", nil, http.StatusBadRequest},
+		{"unauthenticated", "", nil, http.StatusUnauthorized},
+		{"already started", "carol", func(t *testing.T, game *Game) {
+			if w := apiRequest(http.MethodPost, "/games/"+game.ID+"/join", "bob", ""); w.Code != http.StatusOK {
+				t.Fatalf("first join: got %d %s", w.Code, w.Body.String())
+			}
+		}, http.StatusBadRequest},
+		{"aborted", "bob", func(t *testing.T, game *Game) {
+			if w := apiRequest(http.MethodPost, "/games/"+game.ID+"/abort", "alice", ""); w.Code != http.StatusOK {
+				t.Fatalf("abort: got %d %s", w.Code, w.Body.String())
+			}
+		}, http.StatusBadRequest},
+		{"joiner already playing", "bob", func(t *testing.T, game *Game) {
+			if err := db.Create(&Game{ID: "other", WhitePlayerID: "bob", BlackPlayerID: "carol", Status: StatusOngoing, FEN: startingFEN}).Error; err != nil {
+				t.Fatal(err)
+			}
+		}, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testDB(t)
+			createAccounts(t, "alice", "bob", "carol")
+
+			created := createWaitingGame(t)
+			if tt.setup != nil {
+				tt.setup(t, &created)
+			}
+			var before Game
+			db.First(&before, "id = ?", created.ID)
+
+			joined := time.Now()
+			w := apiRequest(http.MethodPost, "/games/"+created.ID+"/join", tt.joiner, "")
+			if w.Code != tt.wantCode {
+				t.Fatalf("got %d %s, want %d", w.Code, w.Body.String(), tt.wantCode)
+			}
+
+			var saved Game
+			if err := db.First(&saved, "id = ?", created.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantCode != http.StatusOK {
+				if saved.Status != before.Status || saved.BlackPlayerID != before.BlackPlayerID {
+					t.Errorf("got %s with black %q, want it untouched", saved.Status, saved.BlackPlayerID)
+				}
+				return
+			}
+
+			if saved.Status != StatusOngoing || saved.WhitePlayerID != "alice" || saved.BlackPlayerID != tt.joiner {
+				t.Errorf("got %s between %q and %q, want ongoing between alice and %s", saved.Status, saved.WhitePlayerID, saved.BlackPlayerID, tt.joiner)
+			}
+			if saved.StartTime.Before(joined.Truncate(time.Second)) {
+				t.Errorf("clocks started at %v, want at the join %v", saved.StartTime, joined)
+			}
+		})
+	}
+}
+
+func TestAbortWaitingGame(t *testing.T) {
+	tests := []struct {
+		name     string
+		player   string
+		wantCode int
+	}{
+		{"by its creator", "alice", http.StatusOK},
+		{"by someone else", "bob", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testDB(t)
+			createAccounts(t, "alice", "bob")
+
+			created := createWaitingGame(t)
+			if w := apiRequest(http.MethodPost, "/games/"+created.ID+"/abort", tt.player, ""); w.Code != tt.wantCode {
+				t.Fatalf("got %d %s, want %d", w.Code, w.Body.String(), tt.wantCode)
+			}
+
+			want := StatusWaiting
+			if tt.wantCode == http.StatusOK {
+				want = StatusAborted
+			}
+			var saved Game
+			if err := db.First(&saved, "id = ?", created.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+			if saved.Status != want {
+				t.Errorf("got %s, want %s", saved.Status, want)
+			}
+		})
+	}
+}
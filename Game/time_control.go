@@ -0,0 +1,142 @@
+package game
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Rating categories, named like the rating fields on account.Account
+const (
+	Bullet    = "bullet"
+	Blitz     = "blitz"
+	Rapid     = "rapid"
+	Classical = "classical"
+
+	// Days per move games, whatever their variant's time control
+	Correspondence = "correspondence"
+)
+
+// Delay types, an empty DelayType means Fischer increment
+const (
+	SimpleDelay    = "simple"
+	BronsteinDelay = "bronstein"
+)
+
+type TimeControl struct {
+	BaseSeconds      int    `json:"base_seconds"`
+	IncrementSeconds int    `json:"increment_seconds"`
+	DelaySeconds     int    `json:"delay_seconds"`
+	DelayType        string `json:"delay_type"`
+}
+
+// "3+2" increment, "5d3" simple delay, "5b3" Bronstein delay, "10" no bonus
+// the base is in minutes and may be fractional ("0.5+0"), the bonus is in seconds
+var timeControlRegex = regexp.MustCompile(`^(\d+(?:\.\d+)?)(?:([+db])(\d+))?$`)
+
+func ParseTimeControl(s string) (TimeControl, error) {
+	var tc TimeControl
+
+	parts := timeControlRegex.FindStringSubmatch(strings.ReplaceAll(s, " ", ""))
+	if parts == nil {
+		return tc, fmt.Errorf("invalid time control %q, expected something like \"3+2\", \"5d3\" or \"5b3\"", s)
+	}
+
+	minutes, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil {
+		return tc, fmt.Errorf("invalid base time %q", parts[1])
+	}
+	tc.BaseSeconds = int(minutes * 60)
+
+	if parts[3] != "" {
+		bonus, err := strconv.Atoi(parts[3])
+		if err != nil {
+			return tc, fmt.Errorf("invalid bonus time %q", parts[3])
+		}
+		tc.setBonus(parts[2], bonus)
+	}
+
+	return tc, tc.Validate()
+}
+
+// Sets the bonus written after the base: "+" increment, "d" simple delay, "b" Bronstein delay
+func (tc *TimeControl) setBonus(kind string, seconds int) {
+	switch kind {
+	case "+":
+		tc.IncrementSeconds = seconds
+	case "d":
+		tc.DelaySeconds = seconds
+		tc.DelayType = SimpleDelay
+	case "b":
+		tc.DelaySeconds = seconds
+		tc.DelayType = BronsteinDelay
+	}
+}
+
+func (tc TimeControl) Validate() error {
+	if tc.BaseSeconds <= 0 {
+		return fmt.Errorf("base time must be positive")
+	}
+	if tc.BaseSeconds > 180*60 {
+		return fmt.Errorf("base time can't be more than 180 minutes")
+	}
+	if tc.IncrementSeconds < 0 || tc.IncrementSeconds > 180 || tc.DelaySeconds < 0 || tc.DelaySeconds > 180 {
+		return fmt.Errorf("increment and delay must be between 0 and 180 seconds")
+	}
+	if tc.IncrementSeconds > 0 && tc.DelaySeconds > 0 {
+		return fmt.Errorf("a time control can't have both increment and delay")
+	}
+	if tc.DelayType != "" && tc.DelayType != SimpleDelay && tc.DelayType != BronsteinDelay {
+		return fmt.Errorf("invalid delay type %q", tc.DelayType)
+	}
+
+	return nil
+}
+
+func (tc TimeControl) String() string {
+	minutes := strconv.FormatFloat(float64(tc.BaseSeconds)/60, 'f', -1, 64)
+
+	switch tc.DelayType {
+	case SimpleDelay:
+		return fmt.Sprintf("%sd%d", minutes, tc.DelaySeconds)
+	case BronsteinDelay:
+		return fmt.Sprintf("%sb%d", minutes, tc.DelaySeconds)
+	}
+
+	return fmt.Sprintf("%s+%d", minutes, tc.IncrementSeconds)
+}
+
+// Category from the expected duration of a 40 move game
+func (tc TimeControl) Category() string {
+	estimated := tc.BaseSeconds + 40*(tc.IncrementSeconds+tc.DelaySeconds)
+
+	switch {
+	case estimated < 180:
+		return Bullet
+	case estimated < 480:
+		return Blitz
+	case estimated < 1500:
+		return Rapid
+	}
+
+	return Classical
+}
+
+// Milliseconds taken off a running clock, a simple delay is not counted
+func (tc TimeControl) charge(elapsed int64) int64 {
+	if tc.DelayType == SimpleDelay {
+		return max(elapsed-int64(tc.DelaySeconds)*1000, 0)
+	}
+
+	return elapsed
+}
+
+// Milliseconds given back to the mover once the move is made
+func (tc TimeControl) bonus(elapsed int64) int64 {
+	if tc.DelayType == BronsteinDelay {
+		return min(elapsed, int64(tc.DelaySeconds)*1000)
+	}
+
+	return int64(tc.IncrementSeconds) * 1000
+}
@@ -1 +1,187 @@
 package game
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	account "project/Account"
+
+	"github.com/notnil/chess"
+	"gorm.io/gorm"
+)
+
+// Results, written like in PGN
+const (
+	WhiteWins = "1-0"
+	BlackWins = "0-1"
+	Drawn     = "1/2-1/2"
+)
+
+var errGameChanged = errors.New("The game changed in the meantime, reload it and try again")
+
+// Columns of a game changed when it ends
+var finishColumns = []string{"status", "result", "termination", "winner_id", "end_time", "white_clock", "black_clock", "last_move_at", "draw_offer_by", "takeback_by"}
+
+// Columns of a game changed by a move, or by taking moves back
+var moveColumns = []string{"moves", "fen", "position_hashes", "move_clocks", "white_clock", "black_clock", "last_move_at", "draw_offer_by", "takeback_by", "move_deadline", "reminder_sent"}
+
+// Writes the columns of a loaded game, but only while its row is still the
+// version that was loaded: errGameChanged when another request moved or
+// ended it first, so one request can't undo another's change
+// the columns of a game that ends with the change are always written,
+// a rated game gets its rating change in the same transaction so two
+// requests ending it at once can't both rate it
+func updateGame(game *Game, columns ...string) error {
+	return updateGameWith(game, nil, columns...)
+}
+
+// updateGame that also runs `also` in the transaction, before the game is
+// written, the whole change is undone when either fails
+func updateGameWith(game *Game, also func(tx *gorm.DB) error, columns ...string) error {
+	ended := game.Status != game.loaded.status && (game.Status == StatusFinished || game.Status == StatusAborted)
+	if ended {
+		columns = append(append([]string{}, columns...), finishColumns...)
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// Before the write, so it still sees the row as it was
+		if also != nil {
+			if err := also(tx); err != nil {
+				return err
+			}
+		}
+
+		// Moves are stored as a JSON blob, read as text by json_array_length
+		result := tx.Model(game).
+			Where("status = ? AND COALESCE(json_array_length(CAST(moves AS TEXT)), 0) = ?", game.loaded.status, game.loaded.plies).
+			Select(columns).Updates(game)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected != 1 {
+			return errGameChanged
+		}
+
+		if ended && game.Status == StatusFinished && game.Rated {
+			return updateRatings(tx, game)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	game.loaded = gameVersion{status: game.Status, plies: len(game.Moves)}
+	scheduleFlag(game, time.Now())
+	if ended {
+		endPartnerGame(game, game.EndTime)
+	}
+
+	return nil
+}
+
+// HTTP status of a failed updateGame
+func updateStatus(err error) int {
+	if err == errGameChanged {
+		return http.StatusConflict
+	}
+
+	return http.StatusInternalServerError
+}
+
+// Marks the game as finished with its result, termination and winner
+func finishGame(game *Game, result string, termination string, now time.Time) error {
+	if !validTerminations[termination] {
+		return fmt.Errorf("invalid termination %q", termination)
+	}
+
+	if err := game.transition(StatusFinished); err != nil {
+		return err
+	}
+
+	game.EndTime = now
+	game.Result = result
+	game.Termination = termination
+
+	switch result {
+	case WhiteWins:
+		game.WinnerID = game.WhitePlayerID
+	case BlackWins:
+		game.WinnerID = game.BlackPlayerID
+	default:
+		game.WinnerID = ""
+	}
+
+	return nil
+}
+
+// Stores the rating change of both players on the game, in the transaction
+// that saves the result, a failure is only logged so the result is still saved
+func updateRatings(tx *gorm.DB, game *Game) error {
+	score := 0.5
+	switch game.Result {
+	case WhiteWins:
+		score = 1
+	case BlackWins:
+		score = 0
+	}
+
+	change, err := account.UpdateRatings(tx, game.ID, game.WhitePlayerID, game.BlackPlayerID, game.GameType, score)
+	if err != nil {
+		log.Printf("failed to update ratings of game %s: %v", game.ID, err)
+		return nil
+	}
+
+	game.WhiteRatingBefore, game.WhiteRatingAfter = change.WhiteBefore, change.WhiteAfter
+	game.BlackRatingBefore, game.BlackRatingAfter = change.BlackBefore, change.BlackAfter
+
+	return tx.Model(game).Select("white_rating_before", "white_rating_after", "black_rating_before", "black_rating_after").Updates(game).Error
+}
+
+// Result of the position reached by the last move, empty while the game goes on
+// threefold repetition and the fifty move rule end the game without a claim
+func detectOutcome(game *Game, pos *position) (string, string) {
+	if result, termination := pos.rules.outcome(pos); result != "" {
+		return result, termination
+	}
+
+	if !pos.hasLegalMove() {
+		// The variant may let the player wait for a move, like a bughouse drop
+		if pos.rules.canWait(pos) {
+			return "", ""
+		}
+		if !pos.inCheck() {
+			return Drawn, TerminationStalemate
+		}
+		if pos.turn() == chess.White {
+			return BlackWins, TerminationCheckmate
+		}
+		return WhiteWins, TerminationCheckmate
+	}
+
+	if pos.rules.positionDraws() {
+		switch count := repetitions(game); {
+		case count >= 5:
+			return Drawn, TerminationFivefoldRepetition
+		case count >= 3:
+			return Drawn, TerminationThreefoldRepetition
+		}
+
+		switch {
+		case pos.halfMoveClock() >= 150:
+			return Drawn, TerminationSeventyFiveMoveRule
+		case pos.halfMoveClock() >= 100:
+			return Drawn, TerminationFiftyMoveRule
+		}
+	}
+
+	switch {
+	case pos.rules.insufficientMaterialDraws() && insufficientMaterial(pos.squares):
+		return Drawn, TerminationInsufficientMaterial
+	}
+
+	return "", ""
+}
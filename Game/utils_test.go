@@ -0,0 +1,57 @@
+package game
+
+import "testing"
+
+func TestDetectOutcome(t *testing.T) {
+	// A rook keeps enough material on the board
+	const rook = "4k3/8/8/8/8/8/8/R3K3 w - - 10 40"
+
+	tests := []struct {
+		name            string
+		fen             string
+		seen            int
+		wantResult      string
+		wantTermination string
+	}{
+		{"nothing", rook, 1, "", ""},
+		{"checkmate", "R3k3/8/4K3/8/8/8/8/8 b - - 0 1", 1, WhiteWins, TerminationCheckmate},
+		{"stalemate", "k7/2Q5/1K6/8/8/8/8/8 b - - 0 1", 1, Drawn, TerminationStalemate},
+
+		{"seen twice", rook, 2, "", ""},
+		{"threefold repetition", rook, 3, Drawn, TerminationThreefoldRepetition},
+		{"seen four times", rook, 4, Drawn, TerminationThreefoldRepetition},
+		{"fivefold repetition", rook, 5, Drawn, TerminationFivefoldRepetition},
+
+		{"99 plies without a capture or pawn move", "4k3/8/8/8/8/8/8/R3K3 w - - 99 80", 1, "", ""},
+		{"fifty-move rule", "4k3/8/8/8/8/8/8/R3K3 w - - 100 80", 1, Drawn, TerminationFiftyMoveRule},
+		{"149 plies without a capture or pawn move", "4k3/8/8/8/8/8/8/R3K3 w - - 149 105", 1, Drawn, TerminationFiftyMoveRule},
+		{"seventy-five-move rule", "4k3/8/8/8/8/8/8/R3K3 w - - 150 105", 1, Drawn, TerminationSeventyFiveMoveRule},
+
+		{"king and pawn", "4k3/8/8/8/8/8/4P3/4K3 w - - 0 1", 1, "", ""},
+		{"two knights", "4k3/8/8/8/8/8/8/1N2K1N1 w - - 0 1", 1, "", ""},
+		{"bishops on both colors", "4k3/8/8/8/8/8/8/2B1KB2 w - - 0 1", 1, "", ""},
+		{"kings only", "4k3/8/8/8/8/8/8/4K3 w - - 0 1", 1, Drawn, TerminationInsufficientMaterial},
+		{"one knight", "4k3/8/8/8/8/8/8/1N2K3 w - - 0 1", 1, Drawn, TerminationInsufficientMaterial},
+		{"bishops on the same color", "4k3/8/8/8/8/8/8/2B1K1B1 w - - 0 1", 1, Drawn, TerminationInsufficientMaterial},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			game := &Game{Variant: VariantStandard}
+			pos, err := newPosition(tt.fen, variantOf(game))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Another position in between each time it was seen
+			for i := 0; i < tt.seen; i++ {
+				game.PositionHashes = append(game.PositionHashes, positionHash(startingFEN), positionHash(pos.fen))
+			}
+
+			result, termination := detectOutcome(game, pos)
+			if result != tt.wantResult || termination != tt.wantTermination {
+				t.Errorf("got %q %q, want %q %q", result, termination, tt.wantResult, tt.wantTermination)
+			}
+		})
+	}
+}
@@ -0,0 +1,229 @@
+package game
+
+import (
+	"fmt"
+
+	"github.com/notnil/chess"
+)
+
+// Rules a game is played with
+const (
+	VariantStandard      = "standard"
+	VariantChess960      = "chess960"
+	VariantFromPosition  = "from_position"
+	VariantKingOfTheHill = "king_of_the_hill"
+	VariantThreeCheck    = "three_check"
+	VariantHorde         = "horde"
+)
+
+const hordeFEN = "rnbqkbnr/pppppppp/8/1PP2PP1/PPPPPPPP/PPPPPPPP/PPPPPPPP/PPPPPPPP w kq - 0 1"
+
+// Hooks a variant changes on top of the standard rules
+type variant interface {
+	name() string
+	// Name in the PGN Variant tag, empty for standard chess
+	pgnName() string
+	// FEN a new game starts from
+	startFEN() string
+	// Rating category on the account, empty to rate by time control
+	ratingPool() string
+
+	// Moves are generated by the game package instead of the chess package
+	generatesMoves() bool
+	// Position handed to the chess package
+	chessFEN(p *position) string
+	// Moves the variant plays itself, ok is false to play the move normally
+	playSpecial(p *position, moveStr string) (played *ply, ok bool, err error)
+	// Moves the variant adds to the ones of the chess package
+	specialMoves(p *position) []*ply
+	// Keeps the variant's own state in the FEN after a normal move
+	afterMove(before *position, after *position, from chess.Square, to chess.Square)
+
+	// Win condition checked after every move, before mate and the draw rules
+	outcome(p *position) (string, string)
+	// The side to move has no move now but may get one later instead of being mated
+	canWait(p *position) bool
+	// Lone minor pieces end the game in a draw
+	insufficientMaterialDraws() bool
+	// Repetitions and the fifty-move rule end the game in a draw
+	positionDraws() bool
+}
+
+var variants = map[string]variant{
+	VariantStandard:      standardRules{},
+	VariantFromPosition:  standardRules{},
+	VariantChess960:      chess960Rules{},
+	VariantKingOfTheHill: kingOfTheHillRules{},
+	VariantThreeCheck:    threeCheckRules{},
+	VariantHorde:         hordeRules{},
+	VariantBughouse:      bughouseRules{},
+}
+
+// Rules of a game, games saved before variants existed are standard
+func variantOf(game *Game) variant {
+	if rules, ok := variants[game.Variant]; ok {
+		return rules
+	}
+
+	return variants[VariantStandard]
+}
+
+type standardRules struct{}
+
+func (standardRules) name() string       { return VariantStandard }
+func (standardRules) pgnName() string    { return "" }
+func (standardRules) startFEN() string   { return startingFEN }
+func (standardRules) ratingPool() string { return "" }
+
+func (standardRules) generatesMoves() bool { return false }
+
+func (standardRules) chessFEN(p *position) string {
+	shown := *p
+	shown.extra = nil
+
+	return shown.encode()
+}
+
+func (standardRules) playSpecial(p *position, moveStr string) (*ply, bool, error) {
+	return nil, false, nil
+}
+
+func (standardRules) specialMoves(p *position) []*ply { return nil }
+
+func (standardRules) afterMove(before *position, after *position, from chess.Square, to chess.Square) {
+}
+
+func (standardRules) outcome(p *position) (string, string) { return "", "" }
+
+func (standardRules) canWait(p *position) bool { return false }
+
+func (standardRules) insufficientMaterialDraws() bool { return true }
+
+func (standardRules) positionDraws() bool { return true }
+
+// Castling rights are rook files and castling is played by the game package
+type chess960Rules struct{ standardRules }
+
+func (chess960Rules) name() string    { return VariantChess960 }
+func (chess960Rules) pgnName() string { return "Chess960" }
+
+func (chess960Rules) chessFEN(p *position) string {
+	shown := *p
+	shown.rights, shown.extra = "", nil
+
+	return shown.encode()
+}
+
+func (chess960Rules) playSpecial(p *position, moveStr string) (*ply, bool, error) {
+	return p.castle960(moveStr)
+}
+
+func (chess960Rules) specialMoves(p *position) []*ply {
+	var plies []*ply
+	for _, c := range p.castles960() {
+		if played, err := p.playCastle(c); err == nil {
+			plies = append(plies, played)
+		}
+	}
+
+	return plies
+}
+
+func (chess960Rules) afterMove(before *position, after *position, from chess.Square, to chess.Square) {
+	after.rights = castlingAfterMove(before, from, to)
+}
+
+// A king reaching one of the four center squares wins
+type kingOfTheHillRules struct{ standardRules }
+
+var hill = []chess.Square{chess.D4, chess.E4, chess.D5, chess.E5}
+
+func (kingOfTheHillRules) name() string       { return VariantKingOfTheHill }
+func (kingOfTheHillRules) pgnName() string    { return "King of the Hill" }
+func (kingOfTheHillRules) ratingPool() string { return VariantKingOfTheHill }
+
+func (kingOfTheHillRules) outcome(p *position) (string, string) {
+	for _, sq := range hill {
+		if piece, ok := p.occupied(sq); ok && piece.Type() == chess.King {
+			if piece.Color() == chess.White {
+				return WhiteWins, TerminationKingOfTheHill
+			}
+			return BlackWins, TerminationKingOfTheHill
+		}
+	}
+
+	return "", ""
+}
+
+// A lone king can still walk to the center
+func (kingOfTheHillRules) insufficientMaterialDraws() bool { return false }
+
+// The third check wins, checks given are kept in a seventh FEN field ("+1+0")
+type threeCheckRules struct{ standardRules }
+
+func (threeCheckRules) name() string       { return VariantThreeCheck }
+func (threeCheckRules) pgnName() string    { return "Three-check" }
+func (threeCheckRules) startFEN() string   { return startingFEN + " +0+0" }
+func (threeCheckRules) ratingPool() string { return VariantThreeCheck }
+
+// Checks given by white and black
+func checksGiven(p *position) (int, int) {
+	var white, black int
+	if len(p.extra) > 0 {
+		fmt.Sscanf(p.extra[0], "+%d+%d", &white, &black)
+	}
+
+	return white, black
+}
+
+func (threeCheckRules) afterMove(before *position, after *position, from chess.Square, to chess.Square) {
+	white, black := checksGiven(before)
+	if after.inCheck() {
+		if before.turn() == chess.White {
+			white++
+		} else {
+			black++
+		}
+	}
+
+	after.extra = []string{fmt.Sprintf("+%d+%d", white, black)}
+}
+
+func (threeCheckRules) outcome(p *position) (string, string) {
+	white, black := checksGiven(p)
+	switch {
+	case white >= 3:
+		return WhiteWins, TerminationThreeChecks
+	case black >= 3:
+		return BlackWins, TerminationThreeChecks
+	}
+
+	return "", ""
+}
+
+// Any piece can still give checks
+func (threeCheckRules) insufficientMaterialDraws() bool { return false }
+
+// White has 36 pawns and no king, black wins by taking all of them
+type hordeRules struct{ standardRules }
+
+func (hordeRules) name() string       { return VariantHorde }
+func (hordeRules) pgnName() string    { return "Horde" }
+func (hordeRules) startFEN() string   { return hordeFEN }
+func (hordeRules) ratingPool() string { return VariantHorde }
+
+// The chess package panics without a white king
+func (hordeRules) generatesMoves() bool { return true }
+
+func (hordeRules) outcome(p *position) (string, string) {
+	for _, piece := range p.squares {
+		if piece != chess.NoPiece && piece.Color() == chess.White {
+			return "", ""
+		}
+	}
+
+	return BlackWins, TerminationHordeDestroyed
+}
+
+// Black can always take the last white pieces
+func (hordeRules) insufficientMaterialDraws() bool { return false }
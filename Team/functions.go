@@ -3,6 +3,7 @@ package team
 import (
 	"net/http"
 	account "project/Account"
+	events "project/Events"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -60,7 +61,8 @@ func CreateTeam(c *gin.Context) {
 }
 
 // POST
-// Adding Member to the team
+// Join a team, or invite another account to your team if you lead it
+// req = team (id or name), account (id or username, yourself when empty)
 func AddMember(c *gin.Context) {
 	accountID, ID_exists := c.Get("accountID")
 
@@ -77,6 +79,7 @@ func AddMember(c *gin.Context) {
 
 	var input struct {
 		TeamIdentifier string `json:"team"` 
+		AccountIdentifier string `json:"account"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -90,6 +93,31 @@ func AddMember(c *gin.Context) {
         return
     }
 
+	// Only the leader brings in someone else, who joins by accepting the invitation
+	if input.AccountIdentifier != "" && input.AccountIdentifier != account.ID && input.AccountIdentifier != account.Username {
+		if team.LeaderID != account.ID {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Only the team leader can add other accounts"})
+			return
+		}
+
+		inviteMember(c, &team, &account, input.AccountIdentifier)
+		return
+	}
+
+	if isMember(&team, account.ID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You are already a member of the team"})
+		return
+	}
+
+	if err := joinTeam(&team, &account); err != nil {
+        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+        return
+    }
+
+    c.JSON(http.StatusOK, gin.H{"team": team})
+}
+
+func joinTeam(team *Team, account *account.Account) error {
 	newMember := Member{
         ID:       account.ID,
         Username: account.Username,
@@ -99,12 +127,152 @@ func AddMember(c *gin.Context) {
 
 	team.Members = append(team.Members, newMember)
 
-    if err := db.Save(&team).Error; err != nil {
-        c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-        return
-    }
+	return db.Save(team).Error
+}
 
-    c.JSON(http.StatusOK, gin.H{"team": team})
+func isMember(team *Team, accountID string) bool {
+	for _, member := range team.Members {
+		if member.ID == accountID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Saves an invitation of the leader and tells the invited account
+func inviteMember(c *gin.Context, team *Team, leader *account.Account, identifier string) {
+	var invited account.Account
+	if err := db.First(&invited, "id = ? or username = ?", identifier, identifier).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+		return
+	}
+
+	if isMember(team, invited.ID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Account is already a member of the team"})
+		return
+	}
+
+	var pending int64
+	db.Model(&Invitation{}).Where("team_id = ? AND account_id = ?", team.ID, invited.ID).Count(&pending)
+	if pending > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Account is already invited to the team"})
+		return
+	}
+
+	invitation := Invitation{
+		ID:        uuid.New().String(),
+		TeamID:    team.ID,
+		TeamName:  team.Name,
+		AccountID: invited.ID,
+		Username:  invited.Username,
+		InvitedBy: leader.Username,
+	}
+
+	if err := db.Create(&invitation).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	events.Publish(invited.ID, events.TypeTeamInvitation, invitation)
+
+	c.JSON(http.StatusOK, gin.H{"invitation": invitation})
+}
+
+// GET
+// Team invitations waiting for your answer
+func GetInvitations(c *gin.Context) {
+	accountID, ID_exists := c.Get("accountID")
+
+	if !ID_exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var invitations []Invitation
+	if err := db.Where("account_id = ?", accountID).Order("created_at").Find(&invitations).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve invitations"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"invitations": invitations})
+}
+
+// Invitation of the url sent to the account asking
+func loadInvitation(c *gin.Context) (*Invitation, bool) {
+	accountID, ID_exists := c.Get("accountID")
+
+	if !ID_exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return nil, false
+	}
+
+	var invitation Invitation
+	if err := db.First(&invitation, "id = ? AND account_id = ?", c.Param("id"), accountID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invitation not found"})
+		return nil, false
+	}
+
+	return &invitation, true
+}
+
+// POST
+// Accept a team invitation, you join the team
+// req = id(from the url)
+func AcceptInvitation(c *gin.Context) {
+	invitation, ok := loadInvitation(c)
+	if !ok {
+		return
+	}
+
+	// Deleted first so a second accept can't join twice
+	result := db.Where("id = ?", invitation.ID).Delete(&Invitation{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invitation not found"})
+		return
+	}
+
+	var team Team
+	if err := db.Preload("Members").First(&team, "id = ?", invitation.TeamID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Team not found"})
+		return
+	}
+
+	var account account.Account
+	if err := db.First(&account, "id = ?", invitation.AccountID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Account not found"})
+		return
+	}
+
+	if !isMember(&team, account.ID) {
+		if err := joinTeam(&team, &account); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"team": team})
+}
+
+// POST
+// Decline a team invitation
+// req = id(from the url)
+func DeclineInvitation(c *gin.Context) {
+	invitation, ok := loadInvitation(c)
+	if !ok {
+		return
+	}
+
+	if err := db.Where("id = ?", invitation.ID).Delete(&Invitation{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Invitation declined"})
 }
 
 // DELETE
@@ -253,5 +421,7 @@ func DeleteTeam(c *gin.Context) {
 		return
 	}
 
+	db.Where("team_id = ?", teamID).Delete(&Invitation{})
+
 	c.JSON(http.StatusOK, gin.H{"message": "Team deleted successfully"})
 }
\ No newline at end of file
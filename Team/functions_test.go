@@ -0,0 +1,207 @@
+package team
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	account "project/Account"
+	events "project/Events"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// A fresh in memory database with a team led by alice, bob and carol have no team
+func testDB(t *testing.T) {
+	t.Helper()
+
+	database, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every connection to :memory: is its own database
+	sqlDB, err := database.DB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() { sqlDB.Close() })
+
+	if err := database.AutoMigrate(&account.Account{}, &Team{}, &Invitation{}, &events.Event{}); err != nil {
+		t.Fatal(err)
+	}
+
+	Init(database)
+	events.Init(database)
+
+	for _, username := range []string{"alice", "bob", "carol"} {
+		if err := db.Create(&account.Account{ID: username + "-id", Username: username, Email: username + "@example.com"}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	team := Team{ID: "team-id", Name: "knights", LeaderID: "alice-id", LeaderName: "alice", Members: []Member{{ID: "alice-id", Username: "alice", TeamID: "team-id", TeamName: "knights"}}}
+	if err := db.Create(&team).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Sends a request as the given account to a router with the team routes
+func teamRequest(method string, path string, accountID string, body string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("accountID", accountID)
+	})
+	router.POST("/teams/members", AddMember)
+	router.GET("/teams/invitations", GetInvitations)
+	router.POST("/teams/invitations/:id/accept", AcceptInvitation)
+	router.POST("/teams/invitations/:id/decline", DeclineInvitation)
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(w, req)
+
+	return w
+}
+
+func members(t *testing.T) map[string]bool {
+	t.Helper()
+
+	var team Team
+	if err := db.Preload("Members").First(&team, "id = ?", "team-id").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	found := map[string]bool{}
+	for _, member := range team.Members {
+		found[member.ID] = true
+	}
+
+	return found
+}
+
+func TestAddMember(t *testing.T) {
+	tests := []struct {
+		name        string
+		accountID   string
+		body        string
+		wantCode    int
+		wantMember  string
+		wantInvited string
+	}{
+		{"join yourself", "bob-id", `{"team": "knights"}`, http.StatusOK, "bob-id", ""},
+		{"leader invites by username", "alice-id", `{"team": "knights", "account": "bob"}`, http.StatusOK, "", "bob-id"},
+		{"leader invites by id", "alice-id", `{"team": "team-id", "account": "carol-id"}`, http.StatusOK, "", "carol-id"},
+		{"member can't invite", "bob-id", `{"team": "knights", "account": "carol"}`, http.StatusForbidden, "", ""},
+		{"unknown account", "alice-id", `{"team": "knights", "account": "dave"}`, http.StatusNotFound, "", ""},
+		{"already a member", "alice-id", `{"team": "knights", "account": "alice-id"}`, http.StatusBadRequest, "alice-id", ""},
+		{"unknown team", "alice-id", `{"team": "rooks", "account": "bob"}`, http.StatusNotFound, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testDB(t)
+
+			w := teamRequest(http.MethodPost, "/teams/members", tt.accountID, tt.body)
+			if w.Code != tt.wantCode {
+				t.Fatalf("got %d %s, want %d", w.Code, w.Body.String(), tt.wantCode)
+			}
+
+			if tt.wantMember != "" && !members(t)[tt.wantMember] {
+				t.Errorf("%s is not a member", tt.wantMember)
+			}
+
+			var invitations []Invitation
+			db.Find(&invitations)
+			if tt.wantInvited == "" {
+				if len(invitations) != 0 {
+					t.Errorf("got invitations %+v, want none", invitations)
+				}
+				return
+			}
+
+			if len(invitations) != 1 || invitations[0].AccountID != tt.wantInvited || invitations[0].InvitedBy != "alice" {
+				t.Fatalf("got invitations %+v, want one of %s by alice", invitations, tt.wantInvited)
+			}
+			if members(t)[tt.wantInvited] {
+				t.Errorf("%s joined before accepting", tt.wantInvited)
+			}
+
+			var sent []events.Event
+			db.Where("account_id = ? AND type = ?", tt.wantInvited, events.TypeTeamInvitation).Find(&sent)
+			if len(sent) != 1 {
+				t.Errorf("got %d invitation events, want 1", len(sent))
+			}
+		})
+	}
+}
+
+func TestAnswerInvitation(t *testing.T) {
+	tests := []struct {
+		name       string
+		accountID  string
+		answer     string
+		wantCode   int
+		wantMember bool
+	}{
+		{"accepted", "bob-id", "accept", http.StatusOK, true},
+		{"declined", "bob-id", "decline", http.StatusOK, false},
+		{"accepted by someone else", "carol-id", "accept", http.StatusNotFound, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testDB(t)
+
+			if w := teamRequest(http.MethodPost, "/teams/members", "alice-id", `{"team": "knights", "account": "bob"}`); w.Code != http.StatusOK {
+				t.Fatalf("invite: got %d %s", w.Code, w.Body.String())
+			}
+			var invitation Invitation
+			if err := db.First(&invitation).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			w := teamRequest(http.MethodPost, "/teams/invitations/"+invitation.ID+"/"+tt.answer, tt.accountID, "")
+			if w.Code != tt.wantCode {
+				t.Fatalf("got %d %s, want %d", w.Code, w.Body.String(), tt.wantCode)
+			}
+			if got := members(t)["bob-id"]; got != tt.wantMember {
+				t.Errorf("bob is a member: %v, want %v", got, tt.wantMember)
+			}
+
+			var left int64
+			db.Model(&Invitation{}).Count(&left)
+			if want := int64(0); tt.wantCode == http.StatusOK && left != want {
+				t.Errorf("%d invitations left, want %d", left, want)
+			}
+
+			// An answered invitation can't be answered again
+			if tt.wantCode == http.StatusOK {
+				if w := teamRequest(http.MethodPost, "/teams/invitations/"+invitation.ID+"/accept", tt.accountID, ""); w.Code != http.StatusNotFound {
+					t.Errorf("second answer: got %d, want %d", w.Code, http.StatusNotFound)
+				}
+			}
+		})
+	}
+}
+
+func TestGetInvitations(t *testing.T) {
+	testDB(t)
+
+	for _, invited := range []string{"bob", "carol"} {
+		if w := teamRequest(http.MethodPost, "/teams/members", "alice-id", `{"team": "knights", "account": "`+invited+`"}`); w.Code != http.StatusOK {
+			t.Fatalf("invite %s: got %d %s", invited, w.Code, w.Body.String())
+		}
+	}
+
+	w := teamRequest(http.MethodGet, "/teams/invitations", "bob-id", "")
+	if w.Code != http.StatusOK || !bytes.Contains(w.Body.Bytes(), []byte(`"username":"bob"`)) || bytes.Contains(w.Body.Bytes(), []byte(`"username":"carol"`)) {
+		t.Errorf("got %d %s, want only the invitation of bob", w.Code, w.Body.String())
+	}
+}
@@ -22,4 +22,17 @@ type Member struct {
 
     TeamID        string    `json:"team_id"`
     TeamName      string    `json:"team_name"`
-}
\ No newline at end of file
+}
+
+// An account a team leader asked to join the team, it joins on accept
+type Invitation struct {
+    ID        string    `json:"id" gorm:"primaryKey"`
+    TeamID    string    `json:"team_id" gorm:"index"`
+    TeamName  string    `json:"team_name"`
+
+    AccountID string    `json:"account_id" gorm:"index"`
+    Username  string    `json:"username"`
+    InvitedBy string    `json:"invited_by"`
+
+    CreatedAt time.Time `json:"created_at"`
+}
@@ -4,6 +4,7 @@ import (
 	"log"
 
 	account "project/Account"
+	events "project/Events"
 	game "project/Game"
 	team "project/Team"
 
@@ -30,7 +31,7 @@ func main() {
 	}
 
 	// Migrate 
-	if err := db.AutoMigrate(&account.Account{}, &game.Game{}, &team.Team{}); err != nil {
+	if err := db.AutoMigrate(&account.Account{}, &account.RatingHistory{}, &game.Game{}, &game.Seek{}, &game.Challenge{}, &team.Team{}, &team.Invitation{}, &events.Event{}); err != nil {
 		panic("failed to migrate database")
 	}
 
@@ -38,6 +39,11 @@ func main() {
 	account.Init(db)
 	game.Init(db)
 	team.Init(db)
+	events.Init(db)
+
+	go game.RunSeekPool()
+	go game.RunCorrespondenceWorker()
+	game.ScheduleFlags()
 
 	// Account Part ===================================================
 	router.POST("/login", account.Login)
@@ -56,21 +62,72 @@ func main() {
 	protected.GET("/accounts", account.GetMyAccount)
 	protected.PUT("/accounts/:id", account.UpdateAccountByID)
 	protected.DELETE("/accounts/:id", account.DeleteAccountbyid)
+	protected.GET("/accounts/:id/ratings", account.GetRatingHistory)
+
+	// Server-Sent Events of the account, resumed with Last-Event-ID
+	protected.GET("/events", events.Stream)
 
 
 	// Game Part =======================================================
 	// error in finding Games 
 
 	router.POST("/games", game.CreateGame)
-	router.PUT("/games/:id/end", game.EndGame)
+	// Authenticated with a ?ticket= since browsers can't set headers on a WebSocket
+	router.GET("/games/:id/ws", game.GameSocket)
+	router.GET("/board.svg", game.RenderFENSVG)
+	router.GET("/board.png", game.RenderFENPNG)
+	protected.POST("/games/import", game.ImportPGN)
+	protected.POST("/games/ws-ticket", game.CreateSocketTicket)
+	protected.PUT("/games/:id/end", game.EndGame)
 	protected.DELETE("/games/:id", game.DeleteGame)
 
-	router.POST("/games/:id/move", game.MakeMove)
+	protected.POST("/games/:id/move", game.MakeMove)
+
+	protected.POST("/games/:id/join", game.JoinGame)
+	protected.POST("/games/:id/abort", game.AbortGame)
+	protected.POST("/games/:id/resign", game.Resign)
+	protected.POST("/games/:id/draw", game.OfferDraw)
+	protected.POST("/games/:id/draw/accept", game.AcceptDraw)
+	protected.POST("/games/:id/draw/decline", game.DeclineDraw)
+	protected.POST("/games/:id/takeback", game.RequestTakeback)
+	protected.POST("/games/:id/takeback/accept", game.AcceptTakeback)
+	protected.POST("/games/:id/takeback/decline", game.DeclineTakeback)
+
 	protected.GET("/games/:id/moves", game.GetMoves) 
+	protected.GET("/games/:id/pgn", game.GetGamePGN)
+	protected.GET("/games/:id/legal-moves", game.GetLegalMoves)
+	protected.GET("/games/:id/position", game.GetPosition)
+	protected.GET("/games/:id/board.svg", game.GetBoardSVG)
+	protected.GET("/games/:id/board.png", game.GetBoardPNG)
+	protected.GET("/games/:id/game.gif", game.GetGameGIF)
+	protected.GET("/accounts/:id/games.pgn", game.ExportAccountGames)
 
 	protected.GET("/games/my", game.GetMyGames) 
 	protected.GET("/games/my/active", game.GetActiveGame)
 
+	protected.POST("/seeks", game.CreateSeek)
+	protected.GET("/seeks", game.GetSeeks)
+	protected.DELETE("/seeks/:id", game.CancelSeek)
+
+	protected.POST("/challenges", game.CreateChallenge)
+	protected.GET("/challenges/incoming", game.GetIncomingChallenges)
+	protected.GET("/challenges/outgoing", game.GetOutgoingChallenges)
+	protected.POST("/challenges/:id/accept", game.AcceptChallenge)
+	protected.POST("/challenges/:id/decline", game.DeclineChallenge)
+	protected.DELETE("/challenges/:id", game.CancelChallenge)
+	protected.POST("/challenges/open", game.CreateOpenChallenge)
+	protected.GET("/challenges/open/:token", game.GetOpenChallenge)
+	protected.POST("/challenges/open/:token", game.ClaimOpenChallenge)
+
+	protected.GET("/vacation", game.GetVacation)
+	protected.POST("/vacation", game.StartVacation)
+	protected.DELETE("/vacation", game.EndVacation)
+
+	protected.POST("/analysis", game.AnalyzePosition)
+
+	protected.POST("/bughouse", game.CreateBughouse)
+	protected.GET("/bughouse/:id", game.GetBughouse)
+
 
 	// Team Part  =======================================================
 
@@ -83,6 +140,10 @@ func main() {
 	protected.DELETE("/teams/:id/members", team.RemoveMember)  
 	protected.GET("/teams/:id/members", team.GetMembers)
 
+	protected.GET("/teams/invitations", team.GetInvitations)
+	protected.POST("/teams/invitations/:id/accept", team.AcceptInvitation)
+	protected.POST("/teams/invitations/:id/decline", team.DeclineInvitation)
+
 	protected.GET("/teams/my", team.GetTeamsByAccountID)
 
 